@@ -0,0 +1,154 @@
+package main
+
+import (
+	"benjitucker/bathrc-accounts/db"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// balanceHistoryDuration is how far back to look for the last imported transaction before a statement.
+const balanceHistoryDuration = time.Hour * 24 * 90 // 90 days
+
+// balanceGap is a break in the running balance, where transactions between two dates are missing.
+type balanceGap struct {
+	From, To     time.Time
+	MissingPence int64 // the total of the missing transactions
+}
+
+func (g balanceGap) String() string {
+	return fmt.Sprintf("%s to %s, %s of transactions missing",
+		g.From.Format("02 Jan 2006"), g.To.Format("02 Jan 2006"), formatAmount(g.MissingPence))
+}
+
+func joinGaps(gaps []balanceGap) string {
+	var parts []string
+	for _, gap := range gaps {
+		parts = append(parts, gap.String())
+	}
+	return strings.Join(parts, "; ")
+}
+
+// hasBalances reports whether a statement gives the balance after each transaction, which not every format does.
+func hasBalances(records []*db.TransactionRecord) bool {
+	for _, record := range records {
+		if record.BalancePence != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// findBalanceGaps checks that each transaction of a statement, oldest first, follows on from the balance of the one
+// before, returning where it does not.
+func findBalanceGaps(records []*db.TransactionRecord) []balanceGap {
+	if !hasBalances(records) {
+		return nil
+	}
+
+	var gaps []balanceGap
+	for i := 1; i < len(records); i++ {
+		previous, current := records[i-1], records[i]
+		missing := current.BalancePence - current.AmountPence - previous.BalancePence
+		if missing != 0 {
+			gaps = append(gaps, balanceGap{From: previous.Date, To: current.Date, MissingPence: missing})
+		}
+	}
+	return gaps
+}
+
+// findHistoryGap checks that the first transaction of a statement, oldest first, follows on from an imported
+// transaction. A statement can start partway through a day that was already partly imported, so it may follow on from
+// a transaction on its first day that is not in the statement, or else from one on the latest day imported before it.
+// It returns nil when it does, or when there is nothing to check against.
+func findHistoryGap(stored []*db.TransactionRecord, statement []*db.TransactionRecord) *balanceGap {
+	first := statement[0]
+	if first.BalancePence == 0 {
+		return nil
+	}
+
+	type line struct {
+		day             time.Time
+		amount, balance int64
+	}
+	inStatement := make(map[line]bool)
+	for _, record := range statement {
+		inStatement[line{dateOnly(record.Date), record.AmountPence, record.BalancePence}] = true
+	}
+
+	firstDay := dateOnly(first.Date)
+	var sameDay, latest []*db.TransactionRecord
+	for _, record := range stored {
+		day := dateOnly(record.Date)
+		if day.After(firstDay) || record.BalancePence == 0 ||
+			inStatement[line{day, record.AmountPence, record.BalancePence}] {
+			continue
+		}
+		switch {
+		case day.Equal(firstDay):
+			sameDay = append(sameDay, record)
+		case len(latest) == 0 || record.Date.After(latest[0].Date):
+			latest = []*db.TransactionRecord{record}
+		case record.Date.Equal(latest[0].Date):
+			latest = append(latest, record)
+		}
+	}
+	if len(sameDay) == 0 && len(latest) == 0 {
+		return nil
+	}
+
+	// The order of the transactions on a day is not stored, so any of them can be the last
+	for _, record := range append(sameDay, latest...) {
+		if record.BalancePence+first.AmountPence == first.BalancePence {
+			return nil
+		}
+	}
+	from := latest
+	if len(sameDay) > 0 {
+		from = sameDay
+	}
+	return &balanceGap{
+		From:         from[0].Date,
+		To:           first.Date,
+		MissingPence: first.BalancePence - first.AmountPence - from[0].BalancePence,
+	}
+}
+
+// getStoredTransactionsBefore gets the imported transactions in the period before a statement starts.
+func getStoredTransactionsBefore(start time.Time) ([]*db.TransactionRecord, error) {
+	var stored []*db.TransactionRecord
+	for _, txnType := range txnTypes {
+		records, err := transactionTable.GetAllOfTypeRecent(txnType, start.Add(-balanceHistoryDuration))
+		if err != nil {
+			return nil, err
+		}
+		stored = append(stored, records...)
+	}
+	return stored, nil
+}
+
+// checkStatementBalances checks the running balance of an uploaded statement. A statement whose own balances do not
+// chain is refused, as transactions are missing from it. A statement that does not follow on from the transactions
+// already imported is accepted, with a warning of the missing period for the treasurer.
+func checkStatementBalances(records []*db.TransactionRecord) (warning string, err error) {
+	ordered := db.Chronological(records)
+	if len(ordered) == 0 || !hasBalances(ordered) {
+		return "", nil
+	}
+
+	gaps := findBalanceGaps(ordered)
+	if len(gaps) > 0 {
+		return "", fmt.Errorf("statement refused, the balances do not follow on: %s", joinGaps(gaps))
+	}
+
+	stored, err := getStoredTransactionsBefore(ordered[0].Date)
+	if err != nil {
+		return "", err
+	}
+	gap := findHistoryGap(stored, ordered)
+	if gap == nil {
+		return "", nil
+	}
+	return fmt.Sprintf("The statement does not follow on from the transactions already imported, a statement "+
+		"for %s is needed.", gap), nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"benjitucker/bathrc-accounts/db"
+	"testing"
+)
+
+func newBalanceTestTransaction(date string, amount, balance int64) *db.TransactionRecord {
+	return &db.TransactionRecord{Date: mustParseDate(date), Type: "CR", AmountPence: amount, BalancePence: balance}
+}
+
+func TestFindBalanceGaps(t *testing.T) {
+	chained := []*db.TransactionRecord{
+		newBalanceTestTransaction("01 Dec 2025", 2000, 10000),
+		newBalanceTestTransaction("02 Dec 2025", -500, 9500),
+		newBalanceTestTransaction("02 Dec 2025", 2500, 12000),
+	}
+	if gaps := findBalanceGaps(chained); len(gaps) != 0 {
+		t.Errorf("expected no gaps, got %v", gaps)
+	}
+
+	broken := []*db.TransactionRecord{
+		newBalanceTestTransaction("01 Dec 2025", 2000, 10000),
+		newBalanceTestTransaction("05 Dec 2025", 2500, 15000),
+	}
+	gaps := findBalanceGaps(broken)
+	if len(gaps) != 1 || gaps[0].MissingPence != 2500 || !gaps[0].From.Equal(mustParseDate("01 Dec 2025")) ||
+		!gaps[0].To.Equal(mustParseDate("05 Dec 2025")) {
+		t.Errorf("unexpected gaps %v", gaps)
+	}
+	if gaps[0].String() != "01 Dec 2025 to 05 Dec 2025, £25.00 of transactions missing" {
+		t.Errorf("unexpected gap description %q", gaps[0].String())
+	}
+
+	// Newest first statements are checked in balance order
+	if gaps := findBalanceGaps(db.Chronological([]*db.TransactionRecord{chained[2], chained[1], chained[0]})); len(gaps) != 0 {
+		t.Errorf("expected no gaps for a newest first statement, got %v", gaps)
+	}
+
+	// The order of a day's transactions is worked out from their balances, not their dates
+	sameDay := []*db.TransactionRecord{
+		newBalanceTestTransaction("02 Dec 2025", 2500, 12000),
+		newBalanceTestTransaction("02 Dec 2025", -500, 9500),
+		newBalanceTestTransaction("02 Dec 2025", 2000, 10000),
+	}
+	ordered := db.Chronological(sameDay)
+	if gaps := findBalanceGaps(ordered); len(gaps) != 0 || ordered[0] != sameDay[2] {
+		t.Errorf("expected a newest first day to be put in balance order, got %v", ordered)
+	}
+
+	// No balances to check
+	noBalances := []*db.TransactionRecord{
+		newBalanceTestTransaction("01 Dec 2025", 2000, 0),
+		newBalanceTestTransaction("05 Dec 2025", 2500, 0),
+	}
+	if gaps := findBalanceGaps(noBalances); len(gaps) != 0 {
+		t.Errorf("expected no gaps without balances, got %v", gaps)
+	}
+}
+
+func statementOf(records ...*db.TransactionRecord) []*db.TransactionRecord {
+	return records
+}
+
+func TestFindHistoryGap(t *testing.T) {
+	stored := []*db.TransactionRecord{
+		newBalanceTestTransaction("28 Nov 2025", 1000, 7000),
+		newBalanceTestTransaction("30 Nov 2025", 500, 8500),
+		newBalanceTestTransaction("30 Nov 2025", 1000, 8000),
+		// Also in the upload
+		newBalanceTestTransaction("01 Dec 2025", 2000, 10500),
+	}
+
+	if gap := findHistoryGap(stored, statementOf(newBalanceTestTransaction("01 Dec 2025", 2000, 10500))); gap != nil {
+		t.Errorf("expected the statement to follow on, got %v", gap)
+	}
+
+	gap := findHistoryGap(stored, statementOf(newBalanceTestTransaction("10 Dec 2025", 2000, 13500)))
+	if gap == nil || gap.MissingPence != 1000 || !gap.From.Equal(mustParseDate("01 Dec 2025")) {
+		t.Errorf("expected a gap from 01 Dec, got %v", gap)
+	}
+
+	if gap := findHistoryGap(nil, statementOf(newBalanceTestTransaction("10 Dec 2025", 2000, 13500))); gap != nil {
+		t.Errorf("expected no gap without history, got %v", gap)
+	}
+
+	// A statement starting partway through a day already partly imported follows on from that day's transactions
+	partDay := append(stored, newBalanceTestTransaction("02 Dec 2025", 1500, 12000))
+	statement := statementOf(
+		newBalanceTestTransaction("02 Dec 2025", 1000, 13000),
+		newBalanceTestTransaction("02 Dec 2025", 500, 13500),
+	)
+	if gap := findHistoryGap(partDay, statement); gap != nil {
+		t.Errorf("expected the statement to follow on from the same day, got %v", gap)
+	}
+
+	// The statement's own transactions, imported before, are not followed on from
+	reimported := append(stored, statement...)
+	gap = findHistoryGap(reimported, statement)
+	if gap == nil || gap.MissingPence != 1500 || !gap.From.Equal(mustParseDate("01 Dec 2025")) {
+		t.Errorf("expected £15.00 missing since 01 Dec, got %v", gap)
+	}
+}
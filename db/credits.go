@@ -0,0 +1,107 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+// CreditRecord is an entry in a member's ledger of money owed between the club and the member. A positive amount is
+// owed to the member by the club, a negative amount is owed to the club by the member.
+type CreditRecord struct {
+	DBItem
+	MemberNumber     string    `dynamodbav:"memberNumber"`
+	Date             time.Time `dynamodbav:"creditDate"`
+	ExpireAt         int64     `dynamodbav:"expireAt"`
+	Kind             string    `dynamodbav:"creditKind"`
+	AmountPence      int64     `dynamodbav:"creditAmount"`
+	TransactionId    string    `dynamodbav:"transactionId"`
+	SubmissionIds    []string  `dynamodbav:"submissionIds"`
+	PaymentReference string    `dynamodbav:"paymentReference"`
+	Note             string    `dynamodbav:"note"`
+}
+
+// Ledger entry kinds
+const (
+	OverpaymentCreditKind  = "OVERPAYMENT"
+	UnderpaymentCreditKind = "UNDERPAYMENT"
+	CancellationCreditKind = "CANCELLATION"
+	ConsumedCreditKind     = "CONSUMED"
+	RefundedCreditKind     = "REFUNDED"
+)
+
+// MakeCreditId builds a repeatable ID for a ledger entry so that processing the same event again overwrites the
+// entry rather than adding a duplicate.
+func MakeCreditId(kind, memberNumber, sourceId string) string {
+	return fmt.Sprintf("%s-%s-%s", kind, memberNumber, sourceId)
+}
+
+func (c CreditRecord) String() string {
+	return fmt.Sprintf("%s | %s | %s | %d | txn %s | ref %s | %s",
+		c.Date.Format("2006-01-02"),
+		c.MemberNumber,
+		c.Kind,
+		c.AmountPence,
+		c.TransactionId,
+		c.PaymentReference,
+		c.Note,
+	)
+}
+
+type CreditTable struct {
+	t *dbTable
+}
+
+func (t *CreditTable) Open(ctx context.Context, ddb *dynamodb.Client) error {
+	t.t = new(dbTable)
+	t.t.ctx = ctx
+	t.t.ddb = ddb
+	t.t.tableName = "Credits"
+	return nil
+}
+
+func (t *CreditTable) Put(record *CreditRecord, id string) error {
+	record.SetID(id)
+	return putItem[*CreditRecord](t.t, record)
+}
+
+func (t *CreditTable) Get(id string) (*CreditRecord, error) {
+	return getItem[*CreditRecord](t.t, id)
+}
+
+func (t *CreditTable) GetAll() ([]*CreditRecord, error) {
+	return scanAllItems[*CreditRecord](t.t)
+}
+
+// GetAllForMember retrieves all the ledger entries for a member.
+func (t *CreditTable) GetAllForMember(memberNumber string) ([]*CreditRecord, error) {
+	keyCond := expression.Key("memberNumber").Equal(expression.Value(memberNumber))
+
+	expr, err := expression.NewBuilder().
+		WithKeyCondition(keyCond).
+		Build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build expression: %v", err)
+	}
+
+	return queryItems[*CreditRecord](t.t, &dynamodb.QueryInput{
+		TableName:                 aws.String(t.t.tableName),
+		IndexName:                 aws.String("MemberDateIndex"),
+		KeyConditionExpression:    expr.KeyCondition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	})
+}
+
+// Balance sums the amounts of the ledger entries.
+func Balance(records []*CreditRecord) int64 {
+	var balance int64
+	for _, record := range records {
+		balance += record.AmountPence
+	}
+	return balance
+}
@@ -70,6 +70,31 @@ func putItem[T dbItemIf](t *dbTable, record T) error {
 	return nil
 }
 
+// putItemIfAbsent stores a record only if there is no item with its ID already, returning whether it was stored.
+func putItemIfAbsent[T dbItemIf](t *dbTable, record T) (bool, error) {
+
+	item, err := attributevalue.MarshalMap(record)
+	if err != nil {
+		return false, err
+	}
+
+	item["ID"] = &types.AttributeValueMemberS{Value: record.GetID()}
+
+	_, err = t.ddb.PutItem(t.ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(t.tableName),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(ID)"),
+	})
+	var conditionErr *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionErr) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to PutItem: table %s; ID %s: %w", t.tableName, record.GetID(), err)
+	}
+	return true, nil
+}
+
 // getItem retrieves an item by id and unmarshals it into the generic type T.
 // T must be a struct or pointer to a struct compatible with attributevalue.UnmarshalMap.
 func getItem[T dbItemIf](t *dbTable, id string) (T, error) {
@@ -139,12 +164,15 @@ func queryItems[T dbItemIf](t *dbTable, query *dynamodb.QueryInput) ([]T, error)
 
 // scanAllItems performs a full table scan and unmarshals all items into a slice of the generic type T.
 func scanAllItems[T dbItemIf](t *dbTable) ([]T, error) {
+	return scanItems[T](t, &dynamodb.ScanInput{
+		TableName: aws.String(t.tableName),
+	})
+}
 
-	var result []T
+// scanItems performs a table scan, e.g. with a filter, and unmarshals the results into a slice of the generic type T.
+func scanItems[T dbItemIf](t *dbTable, input *dynamodb.ScanInput) ([]T, error) {
 
-	input := &dynamodb.ScanInput{
-		TableName: aws.String(t.tableName),
-	}
+	var result []T
 
 	paginator := dynamodb.NewScanPaginator(t.ddb, input)
 
@@ -3,6 +3,7 @@ package db
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
@@ -10,16 +11,45 @@ import (
 
 type MemberRecord struct {
 	DBItem
-	FirstName            string     `dynamodbav:"firstName"`
-	LastName             string     `dynamodbav:"lastName"`
-	DateOfBirth          *time.Time `dynamodbav:"dateOfBirth"`
-	SexAtBirth           string     `dynamodbav:"sexAtBirth"`
-	Email                string     `dynamodbav:"email"`
-	MemberNumber         string     `dynamodbav:"memberNumber"`
-	ClubMembershipStatus string     `dynamodbav:"clubMembershipStatus"`
-	MembershipValidFrom  *time.Time `dynamodbav:"membershipValidFrom"`
-	MembershipValidTo    *time.Time `dynamodbav:"membershipValidTo"`
-	MembershipType       string     `dynamodbav:"membershipType"`
+	FirstName            string             `dynamodbav:"firstName"`
+	LastName             string             `dynamodbav:"lastName"`
+	DateOfBirth          *time.Time         `dynamodbav:"dateOfBirth"`
+	SexAtBirth           string             `dynamodbav:"sexAtBirth"`
+	Email                string             `dynamodbav:"email"`
+	MemberNumber         string             `dynamodbav:"memberNumber"`
+	ClubMembershipStatus string             `dynamodbav:"clubMembershipStatus"`
+	MembershipValidFrom  *time.Time         `dynamodbav:"membershipValidFrom"`
+	MembershipValidTo    *time.Time         `dynamodbav:"membershipValidTo"`
+	MembershipType       string             `dynamodbav:"membershipType"`
+	Memberships          []MembershipPeriod `dynamodbav:"memberships"`
+	Changes              []MemberChange     `dynamodbav:"changes"`
+	RenewalReminderSent  *time.Time         `dynamodbav:"renewalReminderSent"` // the expiry date a reminder was sent for
+	UndeliverableEmail   string             `dynamodbav:"undeliverableEmail"`  // the address that bounced or complained
+	UndeliverableReason  string             `dynamodbav:"undeliverableReason"`
+}
+
+// EmailDeliverable is false once the member's email address has bounced or complained, until it is changed.
+func (m *MemberRecord) EmailDeliverable() bool {
+	return m.Email != "" && (m.UndeliverableEmail == "" || !strings.EqualFold(m.Email, m.UndeliverableEmail))
+}
+
+// MembershipPeriod is one membership product bought by a member, e.g. a junior or family membership, and the dates
+// it is valid for. The MembershipValidFrom, MembershipValidTo, MembershipType and ClubMembershipStatus of the member
+// are those of the period that runs latest.
+type MembershipPeriod struct {
+	Product   string     `dynamodbav:"product"`
+	Type      string     `dynamodbav:"type"`
+	Status    string     `dynamodbav:"status"`
+	ValidFrom *time.Time `dynamodbav:"validFrom"`
+	ValidTo   *time.Time `dynamodbav:"validTo"`
+}
+
+// MemberChange records a change to a member's details found when the membership export was imported.
+type MemberChange struct {
+	Date  time.Time `dynamodbav:"date"`
+	Field string    `dynamodbav:"field"`
+	Old   string    `dynamodbav:"old"`
+	New   string    `dynamodbav:"new"`
 }
 
 func (m MemberRecord) String() string {
@@ -75,7 +105,6 @@ func (t *MemberTable) Get(id string) (*MemberRecord, error) {
 	return result, err
 }
 
-/*
 func (t *MemberTable) GetAll() ([]*MemberRecord, error) {
 	records, err := scanAllItems[*MemberRecord](t.t)
 	if err != nil {
@@ -86,7 +115,6 @@ func (t *MemberTable) GetAll() ([]*MemberRecord, error) {
 	}
 	return records, nil
 }
-*/
 
 // PutAll saves multiple member records to the table, ensuring each record's ID is set to its member number.
 func (t *MemberTable) PutAll(records []*MemberRecord) error {
@@ -0,0 +1,102 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+// OutboxMessage is a rendered email queued to be sent. Its ID is an idempotency key for the email, so queuing the
+// same email again, e.g. when a handler is run again after a failure, does not send it twice.
+type OutboxMessage struct {
+	DBItem
+	EmailDetails
+	Raw         []byte    `dynamodbav:"raw"` // the gzip compressed MIME message
+	Status      string    `dynamodbav:"outboxStatus"`
+	Created     time.Time `dynamodbav:"created"`
+	NextAttempt time.Time `dynamodbav:"nextAttempt"`
+	Attempts    int       `dynamodbav:"attempts"`
+	LastError   string    `dynamodbav:"lastError"`
+	MessageId   string    `dynamodbav:"messageId"` // given by the transport when sent
+	SentAt      time.Time `dynamodbav:"sentAt"`
+	ExpireAt    int64     `dynamodbav:"expireAt"`
+}
+
+// Outbox message states
+const (
+	PendingOutboxStatus = "PENDING"
+	SentOutboxStatus    = "SENT"
+	FailedOutboxStatus  = "FAILED" // given up after too many attempts
+)
+
+func (m OutboxMessage) String() string {
+	return fmt.Sprintf("%s | %s | to %s | %s | attempts %d | %s",
+		m.Created.Format(time.RFC3339),
+		m.Template,
+		strings.Join(m.Recipients, ", "),
+		m.Status,
+		m.Attempts,
+		m.LastError,
+	)
+}
+
+type OutboxTable struct {
+	t *dbTable
+}
+
+func (t *OutboxTable) Open(ctx context.Context, ddb *dynamodb.Client) error {
+	t.t = new(dbTable)
+	t.t.ctx = ctx
+	t.t.ddb = ddb
+	t.t.tableName = "EmailOutbox"
+	return nil
+}
+
+// Add queues a message unless one with the same ID has been queued already, returning whether it was added.
+func (t *OutboxTable) Add(record *OutboxMessage, id string) (bool, error) {
+	record.SetID(id)
+	return putItemIfAbsent[*OutboxMessage](t.t, record)
+}
+
+func (t *OutboxTable) Put(record *OutboxMessage) error {
+	return putItem[*OutboxMessage](t.t, record)
+}
+
+func (t *OutboxTable) Get(id string) (*OutboxMessage, error) {
+	return getItem[*OutboxMessage](t.t, id)
+}
+
+// GetAllAbout retrieves the queued messages about a member number or payment reference.
+func (t *OutboxTable) GetAllAbout(memberNumberOrReference string) ([]*OutboxMessage, error) {
+	input, err := emailsAboutScan(t.t.tableName, memberNumberOrReference)
+	if err != nil {
+		return nil, err
+	}
+	return scanItems[*OutboxMessage](t.t, input)
+}
+
+// GetAllDue retrieves the messages of a status whose next attempt is due by the given time.
+func (t *OutboxTable) GetAllDue(status string, now time.Time) ([]*OutboxMessage, error) {
+	keyCond := expression.Key("outboxStatus").Equal(expression.Value(status)).
+		And(expression.Key("nextAttempt").LessThanEqual(expression.Value(now.Format(time.RFC3339Nano))))
+
+	expr, err := expression.NewBuilder().
+		WithKeyCondition(keyCond).
+		Build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build expression: %v", err)
+	}
+
+	return queryItems[*OutboxMessage](t.t, &dynamodb.QueryInput{
+		TableName:                 aws.String(t.t.tableName),
+		IndexName:                 aws.String("StatusAttemptIndex"),
+		KeyConditionExpression:    expr.KeyCondition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	})
+}
@@ -0,0 +1,89 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+// EmailDetails describes an email and what it was about.
+type EmailDetails struct {
+	Template          string   `dynamodbav:"template"`
+	Subject           string   `dynamodbav:"subject"`
+	Recipients        []string `dynamodbav:"recipients"`
+	MemberNumbers     []string `dynamodbav:"memberNumbers"`
+	SubmissionIds     []string `dynamodbav:"submissionIds"`
+	PaymentReferences []string `dynamodbav:"paymentReferences"`
+}
+
+// SentEmailRecord is a log entry for an email that has been sent.
+type SentEmailRecord struct {
+	DBItem
+	EmailDetails
+	SentAt    time.Time `dynamodbav:"sentAt"`
+	MessageId string    `dynamodbav:"messageId"` // given by the transport
+	ExpireAt  int64     `dynamodbav:"expireAt"`
+}
+
+func (r SentEmailRecord) String() string {
+	return fmt.Sprintf("%s | %s | %s | to %s | members %s | refs %s | message %s",
+		r.SentAt.Format(time.RFC1123),
+		r.Template,
+		r.Subject,
+		strings.Join(r.Recipients, ", "),
+		strings.Join(r.MemberNumbers, ", "),
+		strings.Join(r.PaymentReferences, ", "),
+		r.MessageId,
+	)
+}
+
+type SentEmailTable struct {
+	t *dbTable
+}
+
+func (t *SentEmailTable) Open(ctx context.Context, ddb *dynamodb.Client) error {
+	t.t = new(dbTable)
+	t.t.ctx = ctx
+	t.t.ddb = ddb
+	t.t.tableName = "SentEmails"
+	return nil
+}
+
+func (t *SentEmailTable) Put(record *SentEmailRecord, id string) error {
+	record.SetID(id)
+	return putItem[*SentEmailRecord](t.t, record)
+}
+
+// GetAllAbout retrieves the log entries for the emails about a member number or payment reference.
+func (t *SentEmailTable) GetAllAbout(memberNumberOrReference string) ([]*SentEmailRecord, error) {
+	input, err := emailsAboutScan(t.t.tableName, memberNumberOrReference)
+	if err != nil {
+		return nil, err
+	}
+	return scanItems[*SentEmailRecord](t.t, input)
+}
+
+// emailsAboutScan builds a scan for the emails whose details include a member number or payment reference.
+func emailsAboutScan(tableName, memberNumberOrReference string) (*dynamodb.ScanInput, error) {
+	filter := expression.Contains(expression.Name("memberNumbers"), memberNumberOrReference).
+		Or(expression.Contains(expression.Name("paymentReferences"), memberNumberOrReference))
+
+	expr, err := expression.NewBuilder().
+		WithFilter(filter).
+		Build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build expression: %v", err)
+	}
+
+	return &dynamodb.ScanInput{
+		TableName:                 aws.String(tableName),
+		FilterExpression:          expr.Filter(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	}, nil
+}
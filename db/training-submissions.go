@@ -10,37 +10,92 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 )
 
+// TrainingSubmission is one training session requested on the training form. AlreadyBookedSubmissionId is stored as
+// "alreadyBookedWithId" rather than under its original name, as items written before it held the ID of the earlier
+// booking have a bool under "alreadyBookedSubmissionId" that would fail to unmarshal into a string.
 type TrainingSubmission struct {
 	DBItem
-	SubmissionState           string    `dynamodbav:"submissionState"`
-	TrainingDate              time.Time `dynamodbav:"trainingDate"`
-	PayByDate                 time.Time `dynamodbav:"payByDate"`
-	PaymentRecordId           string    `dynamodbav:"paymentRecordId"`
-	MembershipNumber          string    `dynamodbav:"brcMembership"`
-	Venue                     string    `dynamodbav:"trainingVenue"`
-	AmountPence               int64     `dynamodbav:"amountPence"`
-	HorseName                 string    `dynamodbav:"horseName"`
-	RequestDate               time.Time `dynamodbav:"requestDate"`
-	ExpireAt                  int64     `dynamodbav:"expireAt"`
-	PaymentReference          string    `dynamodbav:"paymentReference"`
-	RequestCurrMem            bool      `dynamodbav:"requestCurrMem"`
-	ActualCurrMem             bool      `dynamodbav:"actualCurrMem"`
-	FoundMemberRecord         bool      `dynamodbav:"foundMemberRecord"`
-	LapsedMembership          bool      `dynamodbav:"lapsedMembership"`
-	AlreadyBooked             bool      `dynamodbav:"alreadyBooked"`
-	AlreadyBookedSubmissionId bool      `dynamodbav:"alreadyBookedSubmissionId"`
-	LinkedSubmissionIds       []string  `dynamodbav:"linkedSubmissionIds"`
-	ReceivedRequestEmailSent  bool      `dynamodbav:"receivedRequestEmailSent"`
-	PayReminderEmailSent      bool      `dynamodbav:"payReminderEmailSent"`
-	PaymentDiscrepancy        bool      `dynamodbav:"paymentDiscrepancy"`
+	SubmissionState           string              `dynamodbav:"submissionState"`
+	TrainingDate              time.Time           `dynamodbav:"trainingDate"`
+	PayByDate                 time.Time           `dynamodbav:"payByDate"`
+	PaymentRecordId           string              `dynamodbav:"paymentRecordId"`
+	MembershipNumber          string              `dynamodbav:"brcMembership"`
+	Venue                     string              `dynamodbav:"trainingVenue"`
+	AmountPence               int64               `dynamodbav:"amountPence"`
+	HorseName                 string              `dynamodbav:"horseName"`
+	RequestDate               time.Time           `dynamodbav:"requestDate"`
+	ExpireAt                  int64               `dynamodbav:"expireAt"`
+	PaymentReference          string              `dynamodbav:"paymentReference"`
+	RequestCurrMem            bool                `dynamodbav:"requestCurrMem"`
+	ActualCurrMem             bool                `dynamodbav:"actualCurrMem"`
+	FoundMemberRecord         bool                `dynamodbav:"foundMemberRecord"`
+	LapsedMembership          bool                `dynamodbav:"lapsedMembership"`
+	AlreadyBooked             bool                `dynamodbav:"alreadyBooked"`
+	AlreadyBookedSubmissionId string              `dynamodbav:"alreadyBookedWithId"`
+	LinkedSubmissionIds       []string            `dynamodbav:"linkedSubmissionIds"`
+	ReceivedRequestEmailSent  bool                `dynamodbav:"receivedRequestEmailSent"`
+	PayReminderEmailSent      bool                `dynamodbav:"payReminderEmailSent"`
+	PaymentDiscrepancy        bool                `dynamodbav:"paymentDiscrepancy"`
+	CancelledDate             time.Time           `dynamodbav:"cancelledDate"`
+	RefundDue                 bool                `dynamodbav:"refundDue"`
+	CreditAppliedPence        int64               `dynamodbav:"creditAppliedPence"`
+	Allocations               []PaymentAllocation `dynamodbav:"paymentAllocations"`
+	RejectedTransactionIds    []string            `dynamodbav:"rejectedTransactionIds"`
+	ExpiryWarningEmailSent    bool                `dynamodbav:"expiryWarningEmailSent"`
+	PriceMismatch             bool                `dynamodbav:"priceMismatch"`
+	PricePence                int64               `dynamodbav:"pricePence"` // the session price when it differs from the amount
+}
+
+// PaymentAllocation is the part of a bank transaction that has been used to pay for a submission. A submission paid
+// in instalments has one allocation per transaction, and a transaction paying for several submissions is split
+// between them.
+type PaymentAllocation struct {
+	TransactionId string `dynamodbav:"transactionId"`
+	AmountPence   int64  `dynamodbav:"amountPence"`
+}
+
+// AmountPaidPence is the total of the payments allocated to the submission.
+func (s *TrainingSubmission) AmountPaidPence() int64 {
+	var paid int64
+	for _, allocation := range s.Allocations {
+		paid += allocation.AmountPence
+	}
+	return paid
+}
+
+// PaymentReceived reports whether any payment has been received for the submission, paying for it in full or in part.
+func (s *TrainingSubmission) PaymentReceived() bool {
+	return s.PaymentRecordId != "" || s.AmountPaidPence() > 0
+}
+
+// AmountDuePence is the amount still to be paid by bank transfer once any credit and payments received so far have
+// been applied.
+func (s *TrainingSubmission) AmountDuePence() int64 {
+	return s.AmountPence - s.CreditAppliedPence - s.AmountPaidPence()
+}
+
+// PaidBy reports whether the transaction has been used to pay for the submission, in full or in part.
+func (s *TrainingSubmission) PaidBy(transactionId string) bool {
+	if s.PaymentRecordId == transactionId {
+		return true
+	}
+	for _, allocation := range s.Allocations {
+		if allocation.TransactionId == transactionId {
+			return true
+		}
+	}
+	return false
 }
 
 // State Machine
 const (
-	ReceivedSubmissionState = "RECEIVED"
-	PaidSubmissionState     = "PAID"
-	InPastSubmissionState   = "IN_PAST"
-	DroppedSubmissionState  = "DROPPED"
+	ReceivedSubmissionState  = "RECEIVED"
+	PaidSubmissionState      = "PAID"
+	InPastSubmissionState    = "IN_PAST"
+	DroppedSubmissionState   = "DROPPED"
+	WaitingSubmissionState   = "WAITING"
+	ExpiredSubmissionState   = "EXPIRED"
+	CancelledSubmissionState = "CANCELLED"
 )
 
 type TrainingSubmissionTable struct {
@@ -114,3 +169,27 @@ func (t *TrainingSubmissionTable) GetAllOfStateRecent(submissionState string, tr
 		ExpressionAttributeValues: expr.Values(),
 	})
 }
+
+// GetAllOfStateBetween retrieves training submissions of a specific state with a training date in the range [from, to].
+func (t *TrainingSubmissionTable) GetAllOfStateBetween(submissionState string, from, to time.Time) ([]*TrainingSubmission, error) {
+	fromStr := from.Format(time.RFC3339)
+	toStr := to.Format(time.RFC3339)
+
+	keyCond := expression.Key("submissionState").Equal(expression.Value(submissionState)).
+		And(expression.Key("trainingDate").Between(expression.Value(fromStr), expression.Value(toStr)))
+
+	expr, err := expression.NewBuilder().
+		WithKeyCondition(keyCond).
+		Build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build expression: %v", err)
+	}
+
+	return queryItems[*TrainingSubmission](t.t, &dynamodb.QueryInput{
+		TableName:                 aws.String(t.t.tableName),
+		IndexName:                 aws.String("StateDateIndex"),
+		KeyConditionExpression:    expr.KeyCondition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	})
+}
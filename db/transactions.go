@@ -5,6 +5,7 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"slices"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -22,6 +23,17 @@ type TransactionRecord struct {
 	LastName     string    `dynamodbav:"txnLastName"`
 	AmountPence  int64     `dynamodbav:"txnAmount"`
 	BalancePence int64     `dynamodbav:"txnBalance"`
+	Occurrence   int       `dynamodbav:"txnOccurrence"`
+	UsedPence    int64     `dynamodbav:"txnUsed"`     // allocated to bookings, whatever state they are now in
+	Consumed     bool      `dynamodbav:"txnConsumed"` // completed the payment of a booking, so nothing is left to use
+}
+
+// RemainingPence is the amount of the transaction not yet allocated to a booking.
+func (t *TransactionRecord) RemainingPence() int64 {
+	if t.Consumed {
+		return 0
+	}
+	return t.AmountPence - t.UsedPence
 }
 
 func (t TransactionRecord) String() string {
@@ -47,7 +59,8 @@ func (t TransactionRecord) String() string {
 	)
 }
 
-// Hash generates a SHA-256 hash of the transaction
+// Hash generates a SHA-256 hash of the transaction. This was the transaction ID before Identity, and is kept to
+// recognise transactions imported with it.
 func (t TransactionRecord) Hash() string {
 	data := fmt.Sprintf(
 		"%s|%s|%s|%s|%s|%d|%d",
@@ -63,6 +76,126 @@ func (t TransactionRecord) Hash() string {
 	return hex.EncodeToString(hash[:])
 }
 
+// Identity generates the ID of a transaction from the fields that are repeated when a statement is downloaded again.
+// The balance is left out as not every statement format has it. Identical transactions on the same day are told
+// apart by their Occurrence.
+func (t TransactionRecord) Identity() string {
+	data := fmt.Sprintf(
+		"%s|%s|%s|%s|%s|%d|%d",
+		t.Date.Format("2006-01-02"),
+		t.Type,
+		t.Description,
+		t.FirstName,
+		t.LastName,
+		t.AmountPence,
+		t.Occurrence,
+	)
+	hash := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(hash[:])
+}
+
+// Chronological returns the transactions of a statement in the order of its running balance, oldest first, whether
+// the statement lists them oldest or newest first. The order is worked out from the balances where they chain, and
+// otherwise from the dates of the first and last transactions.
+func Chronological(records []*TransactionRecord) []*TransactionRecord {
+	if chain := balanceChain(records); chain != nil {
+		return chain
+	}
+	return byDate(records)
+}
+
+// byDate returns the transactions of a statement oldest first, judged by the dates of its first and last transactions.
+func byDate(records []*TransactionRecord) []*TransactionRecord {
+	if len(records) < 2 || !records[0].Date.After(records[len(records)-1].Date) {
+		return records
+	}
+	ordered := make([]*TransactionRecord, len(records))
+	for i, record := range records {
+		ordered[len(records)-1-i] = record
+	}
+	return ordered
+}
+
+// balanceChain returns the transactions of a statement in the order their running balances chain, each balance being
+// the one before plus the amount, or nil when they do not chain. Each transaction leads from the balance before it to
+// the balance after it, and the chain is the path that takes every transaction. Where more than one path fits, such as
+// when a balance is returned to, the earlier transactions by date are taken first.
+func balanceChain(records []*TransactionRecord) []*TransactionRecord {
+	balances := false
+	for _, record := range records {
+		balances = balances || record.BalancePence != 0
+	}
+	if !balances {
+		return nil
+	}
+
+	preferred := byDate(records)
+	next := make(map[int64][]*TransactionRecord)
+	surplus := make(map[int64]int) // transactions leading from a balance less those leading to it
+	for _, record := range preferred {
+		before := record.BalancePence - record.AmountPence
+		next[before] = append(next[before], record)
+		surplus[before]++
+		surplus[record.BalancePence]--
+	}
+
+	// The chain starts from the balance that more transactions lead from than to, or from the earliest transaction
+	// when it ends on the balance it started from
+	start := preferred[0].BalancePence - preferred[0].AmountPence
+	starts := 0
+	for balance, n := range surplus {
+		switch n {
+		case 1:
+			start = balance
+			starts++
+		case 0, -1:
+		default:
+			return nil
+		}
+	}
+	if starts > 1 {
+		return nil
+	}
+
+	type step struct {
+		balance int64
+		record  *TransactionRecord
+	}
+	var chain []*TransactionRecord
+	stack := []step{{balance: start}}
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		if following := next[top.balance]; len(following) > 0 {
+			next[top.balance] = following[1:]
+			stack = append(stack, step{balance: following[0].BalancePence, record: following[0]})
+			continue
+		}
+		stack = stack[:len(stack)-1]
+		if top.record != nil {
+			chain = append(chain, top.record)
+		}
+	}
+	if len(chain) != len(records) {
+		return nil
+	}
+	slices.Reverse(chain)
+	return chain
+}
+
+// AssignIds numbers identical transactions on the same day by their position in the running balance chain, so the
+// same statement exported in another order gets the same IDs, and sets each ID from its Identity. The transactions of
+// a statement whose balances do not chain are numbered oldest first by date.
+func AssignIds(records []*TransactionRecord) {
+	seen := make(map[string]int)
+	for _, record := range Chronological(records) {
+		record.Occurrence = 0
+		key := record.Identity()
+		record.Occurrence = seen[key]
+		seen[key]++
+		record.SetID(record.Identity())
+	}
+}
+
 type TransactionTable struct {
 	t *dbTable
 }
@@ -75,8 +208,8 @@ func (t *TransactionTable) Open(ctx context.Context, ddb *dynamodb.Client) error
 	return nil
 }
 
+// Put saves a transaction record, which must have its ID set by AssignIds.
 func (t *TransactionTable) Put(record *TransactionRecord) error {
-	record.SetID(record.Hash())
 	return putItem[*TransactionRecord](t.t, record)
 }
 
@@ -123,13 +256,7 @@ func (t *TransactionTable) GetAll() ([]*TransactionRecord, error) {
 	return scanAllItems[*TransactionRecord](t.t)
 }
 
-// PutAll saves multiple transaction records to the table, ensuring each record's ID is set to its hash.
+// PutAll saves multiple transaction records to the table, which must have their IDs set by AssignIds.
 func (t *TransactionTable) PutAll(records []*TransactionRecord) error {
-
-	// the record id is its hash
-	for _, record := range records {
-		record.SetID(record.Hash())
-	}
-
 	return updateAllItems[*TransactionRecord](t.t, records)
 }
@@ -0,0 +1,29 @@
+package email
+
+import (
+	"benjitucker/bathrc-accounts/db"
+	"fmt"
+)
+
+type CancellationData struct {
+	FirstName, Venue, TrainingDate, Amount, CutOff string
+	Paid, RefundDue                                bool
+}
+
+// SendCancellation confirms a member's cancellation of a training session and says whether a refund or credit is due.
+func (eh *EmailHandler) SendCancellation(member *db.MemberRecord, submission *db.TrainingSubmission, cutOff string) error {
+	if member == nil {
+		fmt.Printf("Cannot send email, no valid membership number to send it to")
+		return nil
+	}
+
+	return eh.SendEmailPretty(memberRecipients(member), aboutMember(member, submission), "cancellation", &CancellationData{
+		FirstName:    member.FirstName,
+		Venue:        submission.Venue,
+		TrainingDate: formatCustomDateTime(submission.TrainingDate),
+		Amount:       formatAmount(submission.AmountPence),
+		CutOff:       cutOff,
+		Paid:         submission.PaymentRecordId != "",
+		RefundDue:    submission.RefundDue,
+	})
+}
@@ -8,8 +8,8 @@ type ConfirmData struct {
 	FirstName, Venue, TrainingDate string
 }
 
-func (eh *EmailHandler) SendConfirm(member *db.MemberRecord, submission *db.TrainingSubmission) {
-	eh.SendEmailPretty([]string{member.Email}, "confirm", &ConfirmData{
+func (eh *EmailHandler) SendConfirm(member *db.MemberRecord, submission *db.TrainingSubmission) error {
+	return eh.SendEmailPretty(memberRecipients(member), aboutMember(member, submission), "confirm", &ConfirmData{
 		FirstName:    member.FirstName,
 		Venue:        submission.Venue,
 		TrainingDate: formatCustomDateTime(submission.TrainingDate),
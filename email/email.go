@@ -1,21 +1,19 @@
 package email
 
 import (
+	"benjitucker/bathrc-accounts/db"
 	"bytes"
 	"context"
 	"embed"
 	"encoding/base64"
 	"fmt"
 	"html/template"
-	"log"
+	"mime"
 	"path/filepath"
+	"slices"
 	"strings"
 	texttmpl "text/template"
 	"time"
-
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/service/ses"
-	"github.com/aws/aws-sdk-go-v2/service/ses/types"
 )
 
 //go:embed templates/*
@@ -27,12 +25,14 @@ var assetsFS embed.FS
 type EmailTemplates struct {
 	HTML    *template.Template
 	Text    *texttmpl.Template
-	Subject string
+	Subject *texttmpl.Template
 }
 
 type EmailHandler struct {
 	ctx          context.Context
-	sesClient    *ses.Client
+	transport    Transport
+	outbox       Outbox
+	sentLog      SentLog
 	templates    map[string]EmailTemplates
 	params       HandlerParams
 	appIntroFile []byte
@@ -43,11 +43,11 @@ type HandlerParams struct {
 	MonitorEmail, ClubEmail, TrainingEmail string
 }
 
-// NewEmailHandler initializes a new EmailHandler with the provided context, SES client, and configuration parameters.
-func NewEmailHandler(ctx context.Context, sesClient *ses.Client, params HandlerParams) (*EmailHandler, error) {
+// NewEmailHandler initializes a new EmailHandler with the provided context, transport, and configuration parameters.
+func NewEmailHandler(ctx context.Context, transport Transport, params HandlerParams) (*EmailHandler, error) {
 	result := &EmailHandler{
 		ctx:       ctx,
-		sesClient: sesClient,
+		transport: transport,
 		templates: make(map[string]EmailTemplates),
 		params:    params,
 	}
@@ -83,7 +83,11 @@ func NewEmailHandler(ctx context.Context, sesClient *ses.Client, params HandlerP
 			if err != nil {
 				return result, err
 			}
-			et.Subject = strings.TrimSpace(string(b))
+			t, err := texttmpl.New(key).Parse(strings.TrimSpace(string(b)))
+			if err != nil {
+				return result, err
+			}
+			et.Subject = t
 		}
 
 		if htmlFile, ok := m["html"]; ok {
@@ -108,58 +112,59 @@ func NewEmailHandler(ctx context.Context, sesClient *ses.Client, params HandlerP
 	return result, nil
 }
 
-// SendEmail sends a simple text email to a single recipient using AWS SES.
-func (eh *EmailHandler) SendEmail(recipient, subject, body string) {
-
-	// Build the email input
-	input := &ses.SendEmailInput{
-		Destination: &types.Destination{
-			ToAddresses:  []string{recipient},
-			BccAddresses: []string{eh.params.MonitorEmail},
-		},
-		ReplyToAddresses: []string{eh.params.ClubEmail},
-		Message: &types.Message{
-			Subject: &types.Content{
-				Charset: aws.String("UTF-8"),
-				Data:    aws.String(subject),
-			},
-			Body: &types.Body{
-				Text: &types.Content{
-					Charset: aws.String("UTF-8"),
-					Data:    aws.String(body),
-				},
-			},
-		},
-		Source: aws.String(eh.params.TrainingEmail),
-	}
+// SendEmail sends a simple text email to a single recipient.
+func (eh *EmailHandler) SendEmail(recipient, subject, body string) error {
 
-	// Send the email
-	result, err := eh.sesClient.SendEmail(eh.ctx, input)
+	var raw bytes.Buffer
+	raw.WriteString("From: " + eh.params.TrainingEmail + "\r\n")
+	raw.WriteString("To: " + recipient + "\r\n")
+	raw.WriteString("Reply-To: " + eh.params.ClubEmail + "\r\n")
+	raw.WriteString("Subject: " + mime.QEncoding.Encode("UTF-8", subject) + "\r\n")
+	raw.WriteString("MIME-Version: 1.0\r\n")
+	raw.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	raw.WriteString("\r\n")
+	raw.WriteString(body + "\r\n")
+
+	// Send the email, the same email is only sent once an hour
+	key := outboxKey("text", About{}, []string{recipient}, subject, time.Now().Format("2006-01-02T15")+body, nil)
+	err := eh.deliver(key, db.EmailDetails{
+		Template:   "text",
+		Subject:    subject,
+		Recipients: []string{recipient},
+	}, raw.Bytes())
 	if err != nil {
-		log.Fatalf("failed to send email: %v", err)
+		return fmt.Errorf("failed to send email %q to %s: %w", subject, recipient, err)
 	}
+	return nil
+}
 
-	fmt.Println("Email sent! Message ID:", *result.MessageId)
+// destinations are the envelope recipients of a message, which include the monitor email address as a blind copy.
+func (eh *EmailHandler) destinations(recipients []string) []string {
+	return append(slices.Clone(recipients), eh.params.MonitorEmail)
 }
 
 // SendEmailPretty sends a rich HTML and text email to multiple recipients using a specified template.
-func (eh *EmailHandler) SendEmailPretty(recipients []string, templateName string, templateData any) {
-	eh.SendEmailPrettyAttach(recipients, templateName, templateData, "", nil)
+func (eh *EmailHandler) SendEmailPretty(recipients []string, about About, templateName string, templateData any) error {
+	return eh.SendEmailPrettyAttach(recipients, about, templateName, templateData, "", nil)
 }
 
-func (eh *EmailHandler) SendEmailPrettyAttach(
-	recipients []string, templateName string, templateData any, attachName string, attachBytes []byte) {
+func (eh *EmailHandler) SendEmailPrettyAttach(recipients []string, about About, templateName string, templateData any,
+	attachName string, attachBytes []byte) error {
+	if len(recipients) == 0 {
+		fmt.Printf("Cannot send %s email, no deliverable email addresses to send it to\n", templateName)
+		return nil
+	}
 
 	// Render templates
 	subject, htmlBody, textBody, err := eh.Render(templateName, templateData)
 	if err != nil {
-		log.Fatal(err)
+		return fmt.Errorf("failed to render %s email: %w", templateName, err)
 	}
 
 	// Read inline logo
 	logoBytes, err := assetsFS.ReadFile("assets/logo.png")
 	if err != nil {
-		log.Fatal(err)
+		return fmt.Errorf("failed to read logo: %w", err)
 	}
 
 	// Replace placeholder in HTML if needed
@@ -178,7 +183,6 @@ func (eh *EmailHandler) SendEmailPrettyAttach(
 	// ---------- HEADERS ----------
 	raw.WriteString("From: " + eh.params.TrainingEmail + "\r\n")
 	raw.WriteString("To: " + strings.Join(recipients, ", ") + "\r\n")
-	raw.WriteString("Bcc: " + eh.params.MonitorEmail + "\r\n")
 	raw.WriteString("Reply-To: " + eh.params.ClubEmail + "\r\n")
 	raw.WriteString("Subject: " + subject + "\r\n")
 	raw.WriteString("MIME-Version: 1.0\r\n")
@@ -225,10 +229,10 @@ func (eh *EmailHandler) SendEmailPrettyAttach(
 	// close alternative
 	raw.WriteString("--" + altBoundary + "--\r\n")
 
-	// ---------- PDF attachment ----------
+	// ---------- attachment ----------
 	if attachName != "" && attachBytes != nil {
 		raw.WriteString("--" + mixedBoundary + "\r\n")
-		raw.WriteString("Content-Type: application/pdf; name=\"" + attachName + "\"\r\n")
+		raw.WriteString("Content-Type: " + attachmentContentType(attachName) + "; name=\"" + attachName + "\"\r\n")
 		raw.WriteString("Content-Transfer-Encoding: base64\r\n")
 		raw.WriteString("Content-Disposition: attachment; filename=\"" + attachName + "\"\r\n\r\n")
 
@@ -243,21 +247,32 @@ func (eh *EmailHandler) SendEmailPrettyAttach(
 	// close mixed
 	raw.WriteString("--" + mixedBoundary + "--\r\n")
 
-	input := &ses.SendRawEmailInput{
-		Source:       aws.String(eh.params.TrainingEmail), // sender
-		Destinations: append(recipients, eh.params.MonitorEmail),
-		RawMessage: &types.RawMessage{
-			Data: raw.Bytes(),
-		},
-	}
-
-	// --- Send SES Raw Email ---
-	_, err = eh.sesClient.SendRawEmail(eh.ctx, input)
+	// --- Send Raw Email, the monitor email is a blind copy ---
+	key := outboxKey(templateName, about, recipients, subject, textBody, attachBytes)
+	err = eh.deliver(key, db.EmailDetails{
+		Template:          templateName,
+		Subject:           subject,
+		Recipients:        recipients,
+		MemberNumbers:     about.MemberNumbers,
+		SubmissionIds:     about.SubmissionIds,
+		PaymentReferences: about.PaymentReferences,
+	}, raw.Bytes())
 	if err != nil {
-		log.Fatalf("failed to send email: %v", err)
+		return fmt.Errorf("failed to send %s email to %s: %w", templateName, strings.Join(recipients, ", "), err)
 	}
+	return nil
+}
 
-	log.Println("Email sent with inline logo")
+// attachmentContentType returns the MIME type for an attachment from its file extension.
+func attachmentContentType(name string) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".pdf":
+		return "application/pdf"
+	case ".csv":
+		return "text/csv"
+	default:
+		return "application/octet-stream"
+	}
 }
 
 // Render evaluates the HTML, text, and subject templates for a given template name and data.
@@ -267,7 +282,13 @@ func (eh *EmailHandler) Render(templateName string, data any) (subject, html, te
 		return "", "", "", fmt.Errorf("template %s not found", templateName)
 	}
 
-	subject = t.Subject
+	if t.Subject != nil {
+		var buf bytes.Buffer
+		if err := t.Subject.Execute(&buf, data); err != nil {
+			return "", "", "", err
+		}
+		subject = buf.String()
+	}
 
 	if t.HTML != nil {
 		var buf bytes.Buffer
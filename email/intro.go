@@ -14,17 +14,15 @@ type IntroData struct {
 	MemberNumber string
 }
 
-func (eh *EmailHandler) SendAppIntro(member *db.MemberRecord) {
+func (eh *EmailHandler) SendAppIntro(member *db.MemberRecord) error {
 	if eh.appIntroFile == nil {
 		var err error
 		eh.appIntroFile, err = eh.introPdfBytes()
 		if err != nil {
-			fmt.Printf("Failed to read app intro PDF: %v", err)
-			return
+			return fmt.Errorf("failed to read app intro PDF: %w", err)
 		}
 	}
-	email := member.Email
-	eh.SendEmailPrettyAttach([]string{email}, "intro", &IntroData{
+	return eh.SendEmailPrettyAttach(memberRecipients(member), aboutMember(member), "intro", &IntroData{
 		FirstName:    member.FirstName,
 		MemberNumber: member.MemberNumber,
 	}, "Training App Instructions.pdf", eh.appIntroFile)
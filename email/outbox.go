@@ -0,0 +1,199 @@
+package email
+
+import (
+	"benjitucker/bathrc-accounts/db"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	outboxTTL          = time.Hour * 24 * 90 // keep for 90 days, the period over which emails are not repeated
+	outboxMaxAttempts  = 8
+	outboxRetryDelay   = time.Minute * 5
+	outboxMaxDelay     = time.Hour * 12
+	outboxMaxRawLength = 350 * 1024 // stay within the DynamoDB item size limit, larger messages are sent directly
+)
+
+// Outbox stores messages until they have been sent, see db.OutboxTable.
+type Outbox interface {
+	Add(record *db.OutboxMessage, id string) (bool, error)
+	Put(record *db.OutboxMessage) error
+	Get(id string) (*db.OutboxMessage, error)
+	GetAllDue(status string, now time.Time) ([]*db.OutboxMessage, error)
+}
+
+// UseOutbox queues emails in an outbox before they are sent, so that failed sends are retried by DrainOutbox and
+// an email that is queued more than once is only sent once.
+func (eh *EmailHandler) UseOutbox(outbox Outbox) {
+	eh.outbox = outbox
+}
+
+// outboxKey is the idempotency key for an email. An email about bookings is identified by the bookings, its template
+// and any attachment, so it is sent once however its wording changes. Other emails are identified by their content.
+func outboxKey(templateName string, about About, recipients []string, subject, text string, attachment []byte) string {
+	hash := sha256.New()
+	if len(about.SubmissionIds) > 0 {
+		ids := slices.Clone(about.SubmissionIds)
+		slices.Sort(ids)
+		hash.Write([]byte(strings.Join(ids, ",")))
+		hash.Write([]byte{0})
+		hash.Write([]byte(about.Event))
+	} else {
+		hash.Write([]byte(strings.Join(recipients, ",")))
+		hash.Write([]byte{0})
+		hash.Write([]byte(subject))
+		hash.Write([]byte{0})
+		hash.Write([]byte(text))
+	}
+	hash.Write([]byte{0})
+	hash.Write(attachment)
+	return templateName + "-" + hex.EncodeToString(hash.Sum(nil)[:16])
+}
+
+// retryDelay is the time to wait before the next attempt after a number of failed attempts, doubling each time.
+func retryDelay(attempts int) time.Duration {
+	delay := outboxRetryDelay
+	for i := 1; i < attempts && delay < outboxMaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, outboxMaxDelay)
+}
+
+// deliver queues a message in the outbox, if there is one, and makes the first attempt to send it. Once the message
+// is queued a failed send is not an error as the message will be retried.
+func (eh *EmailHandler) deliver(key string, details db.EmailDetails, raw []byte) error {
+	var compressed []byte
+	if eh.outbox != nil {
+		var err error
+		compressed, err = compress(raw)
+		if err != nil {
+			return err
+		}
+	}
+	if eh.outbox == nil || len(compressed) > outboxMaxRawLength {
+		// Without an outbox, or too large for one, send directly
+		messageId, err := eh.transport.Send(eh.ctx, eh.params.TrainingEmail, eh.destinations(details.Recipients), raw)
+		if err != nil {
+			return err
+		}
+		log.Printf("Email %s sent, message ID %s", key, messageId)
+		eh.logSent(key, details, messageId, time.Now())
+		return nil
+	}
+
+	now := time.Now()
+	message := &db.OutboxMessage{
+		EmailDetails: details,
+		Raw:          compressed,
+		Status:       db.PendingOutboxStatus,
+		Created:      now,
+		NextAttempt:  now,
+		ExpireAt:     now.Add(outboxTTL).Unix(),
+	}
+	added, err := eh.outbox.Add(message, key)
+	if err != nil {
+		return fmt.Errorf("failed to queue email %s: %w", key, err)
+	}
+	if !added {
+		existing, err := eh.outbox.Get(key)
+		if err != nil {
+			return fmt.Errorf("failed to get queued email %s: %w", key, err)
+		}
+		if existing == nil || existing.Status == db.SentOutboxStatus {
+			log.Printf("Email %s has already been sent, not sending again", key)
+			return nil
+		}
+
+		// Not sent yet, or given up on, so queue it again and send it now
+		log.Printf("Email %s is %s after %d attempts, queueing it again", key, existing.Status, existing.Attempts)
+		message.SetID(key)
+		err = eh.outbox.Put(message)
+		if err != nil {
+			return fmt.Errorf("failed to queue email %s: %w", key, err)
+		}
+	}
+
+	return eh.attempt(message, now)
+}
+
+// attempt tries to send a queued message and records the result in the outbox.
+func (eh *EmailHandler) attempt(message *db.OutboxMessage, now time.Time) error {
+	raw, err := decompress(message.Raw)
+	if err == nil {
+		message.MessageId, err = eh.transport.Send(eh.ctx, eh.params.TrainingEmail,
+			eh.destinations(message.Recipients), raw)
+	}
+
+	message.Attempts++
+	if err == nil {
+		message.Status = db.SentOutboxStatus
+		message.SentAt = now
+		message.LastError = ""
+		log.Printf("Email %s sent, message ID %s", message.GetID(), message.MessageId)
+		eh.logSent(message.GetID(), message.EmailDetails, message.MessageId, now)
+	} else {
+		message.LastError = err.Error()
+		if message.Attempts >= outboxMaxAttempts {
+			message.Status = db.FailedOutboxStatus
+		} else {
+			message.NextAttempt = now.Add(retryDelay(message.Attempts))
+		}
+		log.Printf("Email %s attempt %d failed: %v", message.GetID(), message.Attempts, err)
+	}
+
+	return eh.outbox.Put(message)
+}
+
+// DrainOutbox retries the queued messages that are due, returning those that have now failed too many times to be
+// retried again.
+func (eh *EmailHandler) DrainOutbox(now time.Time) ([]*db.OutboxMessage, error) {
+	if eh.outbox == nil {
+		return nil, nil
+	}
+
+	messages, err := eh.outbox.GetAllDue(db.PendingOutboxStatus, now)
+	if err != nil {
+		return nil, err
+	}
+
+	var failed []*db.OutboxMessage
+	for _, message := range messages {
+		err = eh.attempt(message, now)
+		if err != nil {
+			return failed, err
+		}
+		if message.Status == db.FailedOutboxStatus {
+			failed = append(failed, message)
+		}
+	}
+	return failed, nil
+}
+
+func compress(raw []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(raw); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decompress(compressed []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress queued email: %w", err)
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
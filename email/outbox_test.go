@@ -0,0 +1,256 @@
+package email
+
+import (
+	"benjitucker/bathrc-accounts/db"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// memOutbox is an in memory Outbox
+type memOutbox struct {
+	messages map[string]*db.OutboxMessage
+}
+
+func (o *memOutbox) Add(record *db.OutboxMessage, id string) (bool, error) {
+	if _, ok := o.messages[id]; ok {
+		return false, nil
+	}
+	record.SetID(id)
+	o.messages[id] = record
+	return true, nil
+}
+
+func (o *memOutbox) Put(record *db.OutboxMessage) error {
+	o.messages[record.GetID()] = record
+	return nil
+}
+
+func (o *memOutbox) Get(id string) (*db.OutboxMessage, error) {
+	return o.messages[id], nil
+}
+
+func (o *memOutbox) GetAllDue(status string, now time.Time) ([]*db.OutboxMessage, error) {
+	var due []*db.OutboxMessage
+	for _, message := range o.messages {
+		if message.Status == status && !message.NextAttempt.After(now) {
+			due = append(due, message)
+		}
+	}
+	return due, nil
+}
+
+// flakyTransport fails while down and records the messages it sends otherwise
+type flakyTransport struct {
+	down bool
+	sent [][]byte
+}
+
+func (f *flakyTransport) Send(_ context.Context, _ string, _ []string, raw []byte) (string, error) {
+	if f.down {
+		return "", errors.New("throttled")
+	}
+	f.sent = append(f.sent, raw)
+	return "msg-id", nil
+}
+
+func newOutboxHandler(t *testing.T, transport Transport) (*EmailHandler, *memOutbox) {
+	t.Helper()
+	eh, err := NewEmailHandler(context.Background(), transport, HandlerParams{
+		MonitorEmail:  "monitor@example.com",
+		TrainingEmail: "training@example.com",
+	})
+	if err != nil {
+		t.Fatalf("NewEmailHandler returned error: %v", err)
+	}
+	outbox := &memOutbox{messages: make(map[string]*db.OutboxMessage)}
+	eh.UseOutbox(outbox)
+	return eh, outbox
+}
+
+func TestOutbox_SendsOnce(t *testing.T) {
+	transport := &flakyTransport{}
+	eh, outbox := newOutboxHandler(t, transport)
+
+	member := &db.MemberRecord{FirstName: "Jane", Email: "jane@example.com"}
+	submission := &db.TrainingSubmission{Venue: "Widbrook", PaymentReference: "ABCD"}
+	submission.SetID("sub1")
+	for range 2 {
+		if err := eh.SendSessionFull(member, submission); err != nil {
+			t.Fatalf("SendSessionFull returned error: %v", err)
+		}
+	}
+	// Still the same email about the booking when its wording changes
+	member.FirstName = "Janet"
+	if err := eh.SendSessionFull(member, submission); err != nil {
+		t.Fatalf("SendSessionFull returned error: %v", err)
+	}
+
+	if len(transport.sent) != 1 {
+		t.Errorf("expected the email to be sent once, sent %d times", len(transport.sent))
+	}
+	if len(outbox.messages) != 1 {
+		t.Fatalf("expected 1 queued message, got %d", len(outbox.messages))
+	}
+	for _, message := range outbox.messages {
+		if message.Status != db.SentOutboxStatus || message.MessageId != "msg-id" || message.Attempts != 1 {
+			t.Errorf("unexpected message state: %s %q %d", message.Status, message.MessageId, message.Attempts)
+		}
+		if !strings.HasPrefix(message.GetID(), "session-full-") {
+			t.Errorf("expected the key to start with the template name, got %s", message.GetID())
+		}
+	}
+}
+
+func TestOutbox_DistinctEmails(t *testing.T) {
+	transport := &flakyTransport{}
+	eh, _ := newOutboxHandler(t, transport)
+
+	// Reports with the same text and a different attachment
+	data := &ReconciliationReportData{Date: "22 Dec 2025", UnmatchedPayments: 1}
+	for _, csv := range []string{"a,b\n1,2\n", "a,b\n3,4\n"} {
+		if err := eh.SendReconciliationReport("treasurer@example.com", data, "report.csv", []byte(csv)); err != nil {
+			t.Fatalf("SendReconciliationReport returned error: %v", err)
+		}
+	}
+	if len(transport.sent) != 2 {
+		t.Errorf("expected both reports to be sent, sent %d", len(transport.sent))
+	}
+
+	// Different problems with the same booking
+	member := &db.MemberRecord{MemberNumber: "M100", FirstName: "Jane", Email: "jane@example.com"}
+	submission := &db.TrainingSubmission{MembershipNumber: "M100", Venue: "Widbrook", PaymentReference: "ABCD"}
+	submission.SetID("sub1")
+	for _, description := range []string{"part payment of £10.00", "part payment of £5.00", "part payment of £5.00"} {
+		if err := eh.SendProblemMessage([]*db.MemberRecord{member}, submission, description); err != nil {
+			t.Fatalf("SendProblemMessage returned error: %v", err)
+		}
+	}
+	if len(transport.sent) != 4 {
+		t.Errorf("expected each problem to be sent once, sent %d emails", len(transport.sent)-2)
+	}
+}
+
+func TestOutbox_RetriesUntilSent(t *testing.T) {
+	transport := &flakyTransport{down: true}
+	eh, outbox := newOutboxHandler(t, transport)
+
+	// A queued email is not an error, even when the send fails
+	if err := eh.SendEmail("admin@example.com", "subject", "body"); err != nil {
+		t.Fatalf("SendEmail returned error: %v", err)
+	}
+
+	var message *db.OutboxMessage
+	for _, m := range outbox.messages {
+		message = m
+	}
+	if message == nil || message.Status != db.PendingOutboxStatus || message.LastError != "throttled" {
+		t.Fatalf("expected a pending message with the send error, got %+v", message)
+	}
+
+	now := time.Now()
+	failed, err := eh.DrainOutbox(now)
+	if err != nil || len(failed) != 0 {
+		t.Fatalf("DrainOutbox returned %v, %v", failed, err)
+	}
+	if message.Attempts != 1 {
+		t.Errorf("expected no retry before the message is due, attempts %d", message.Attempts)
+	}
+
+	transport.down = false
+	_, err = eh.DrainOutbox(now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("DrainOutbox returned error: %v", err)
+	}
+	if message.Status != db.SentOutboxStatus || message.Attempts != 2 || len(transport.sent) != 1 {
+		t.Errorf("expected the message to be sent on the retry, got %s after %d attempts",
+			message.Status, message.Attempts)
+	}
+	if !strings.Contains(string(transport.sent[0]), "Subject: subject") {
+		t.Errorf("expected the original message to be sent, got %q", transport.sent[0])
+	}
+}
+
+func TestOutbox_GivesUp(t *testing.T) {
+	transport := &flakyTransport{down: true}
+	eh, _ := newOutboxHandler(t, transport)
+
+	if err := eh.SendEmail("admin@example.com", "subject", "body"); err != nil {
+		t.Fatalf("SendEmail returned error: %v", err)
+	}
+
+	now := time.Now()
+	var failed []*db.OutboxMessage
+	for range outboxMaxAttempts {
+		now = now.Add(outboxMaxDelay)
+		f, err := eh.DrainOutbox(now)
+		if err != nil {
+			t.Fatalf("DrainOutbox returned error: %v", err)
+		}
+		failed = append(failed, f...)
+	}
+
+	if len(failed) != 1 {
+		t.Fatalf("expected the message to fail once, got %d", len(failed))
+	}
+	if failed[0].Status != db.FailedOutboxStatus || failed[0].Attempts != outboxMaxAttempts {
+		t.Errorf("unexpected failed message: %s after %d attempts", failed[0].Status, failed[0].Attempts)
+	}
+
+	// A failed email can be queued again
+	transport.down = false
+	if err := eh.SendEmail("admin@example.com", "subject", "body"); err != nil {
+		t.Fatalf("SendEmail returned error: %v", err)
+	}
+	if len(transport.sent) != 1 {
+		t.Errorf("expected the failed email to be sent when queued again, sent %d", len(transport.sent))
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 5 * time.Minute},
+		{2, 10 * time.Minute},
+		{4, 40 * time.Minute},
+		{10, 12 * time.Hour},
+	}
+	for _, tt := range tests {
+		if got := retryDelay(tt.attempts); got != tt.want {
+			t.Errorf("retryDelay(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestUndeliverableMembersNotEmailed(t *testing.T) {
+	transport := &flakyTransport{}
+	eh, _ := newOutboxHandler(t, transport)
+
+	bounced := &db.MemberRecord{MemberNumber: "M100", FirstName: "Jane", Email: "jane@example.com",
+		UndeliverableEmail: "jane@example.com"}
+	other := &db.MemberRecord{MemberNumber: "M101", FirstName: "John", Email: "john@example.com"}
+	submission := &db.TrainingSubmission{MembershipNumber: "M100", Venue: "Widbrook", PaymentReference: "ABCD"}
+	submission.SetID("sub1")
+
+	if err := eh.SendSessionFull(bounced, submission); err != nil {
+		t.Fatalf("SendSessionFull returned error: %v", err)
+	}
+	if len(transport.sent) != 0 {
+		t.Fatalf("expected no email to an undeliverable address, sent %d", len(transport.sent))
+	}
+
+	err := eh.SendReceivedRequest([]*db.MemberRecord{bounced, other}, []*db.TrainingSubmission{submission}, "")
+	if err != nil {
+		t.Fatalf("SendReceivedRequest returned error: %v", err)
+	}
+	if len(transport.sent) != 1 {
+		t.Fatalf("expected 1 email, sent %d", len(transport.sent))
+	}
+	if sent := string(transport.sent[0]); !strings.Contains(sent, "To: john@example.com\r\n") {
+		t.Errorf("expected the email to go to the deliverable member only, got headers %q", sent[:200])
+	}
+}
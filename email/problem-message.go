@@ -9,26 +9,18 @@ type ProblemMessageData struct {
 	FirstName, Venue, TrainingDate, Description string
 }
 
-func (eh *EmailHandler) SendProblemMessage(members []*db.MemberRecord, submission *db.TrainingSubmission, description string) {
+func (eh *EmailHandler) SendProblemMessage(members []*db.MemberRecord, submission *db.TrainingSubmission, description string) error {
 	if len(members) == 0 {
 		fmt.Printf("Cannot send email, no valid membership numbers to send them too")
-		return
+		return nil
 	}
 
-	// Assume max entry 2 submission
-	var recipients []string
-	var firstNames string
-	if len(members) == 1 || members[0].GetID() == members[1].GetID() {
-		recipients = append(recipients, members[0].Email)
-		firstNames = members[0].FirstName
-	} else {
-		for _, member := range members {
-			recipients = append(recipients, member.Email)
-		}
-		firstNames = fmt.Sprintf("%s and %s", members[0].FirstName, members[1].FirstName)
-	}
+	recipients, firstNames := recipientsAndNames(members)
+	related := aboutMembers(members, []*db.TrainingSubmission{submission})
+	// A booking can have more than one problem, such as successive part payments
+	related.Event = description
 
-	eh.SendEmailPretty(recipients, "problem-message", &ProblemMessageData{
+	return eh.SendEmailPretty(recipients, related, "problem-message", &ProblemMessageData{
 		FirstName:    firstNames,
 		Venue:        submission.Venue,
 		TrainingDate: formatCustomDateTime(submission.TrainingDate),
@@ -0,0 +1,14 @@
+package email
+
+type ReconciliationReportData struct {
+	Date                                                          string
+	UnmatchedPayments, OverdueBookings, Discrepancies, NearMisses int
+}
+
+// SendReconciliationReport emails the treasurer a summary of the payment reconciliation exceptions, with the
+// details attached as a CSV file.
+func (eh *EmailHandler) SendReconciliationReport(recipient string, data *ReconciliationReportData,
+	csvName string, csvBytes []byte) error {
+
+	return eh.SendEmailPrettyAttach([]string{recipient}, About{}, "reconciliation-report", data, csvName, csvBytes)
+}
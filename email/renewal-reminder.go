@@ -0,0 +1,45 @@
+package email
+
+import (
+	"benjitucker/bathrc-accounts/db"
+	"fmt"
+)
+
+type RenewalReminderData struct {
+	FirstName, MemberNumber, ExpiryDate string
+}
+
+type MembershipExpiryData struct {
+	FirstName, MemberNumber, ExpiryDate string
+	Sessions                            []SessionData
+}
+
+// SendRenewalReminder reminds a member that their club membership is about to expire.
+func (eh *EmailHandler) SendRenewalReminder(member *db.MemberRecord) error {
+	if member == nil || member.MembershipValidTo == nil {
+		fmt.Printf("Cannot send email, no membership expiry to remind about")
+		return nil
+	}
+
+	return eh.SendEmailPretty(memberRecipients(member), aboutMember(member), "renewal-reminder", &RenewalReminderData{
+		FirstName:    member.FirstName,
+		MemberNumber: member.MemberNumber,
+		ExpiryDate:   formatCustomDate(*member.MembershipValidTo),
+	})
+}
+
+// SendMembershipExpiryWarning warns a member that they have booked training sessions as a member for dates after their
+// club membership expires.
+func (eh *EmailHandler) SendMembershipExpiryWarning(member *db.MemberRecord, submissions []*db.TrainingSubmission) error {
+	if member == nil || member.MembershipValidTo == nil || len(submissions) == 0 {
+		fmt.Printf("Cannot send email, no membership expiry or sessions to warn about")
+		return nil
+	}
+
+	return eh.SendEmailPretty(memberRecipients(member), aboutMember(member, submissions...), "membership-expiry", &MembershipExpiryData{
+		FirstName:    member.FirstName,
+		MemberNumber: member.MemberNumber,
+		ExpiryDate:   formatCustomDate(*member.MembershipValidTo),
+		Sessions:     sessionList([]*db.MemberRecord{member}, submissions),
+	})
+}
@@ -0,0 +1,68 @@
+package email
+
+import (
+	"benjitucker/bathrc-accounts/db"
+	"fmt"
+	"slices"
+	"time"
+)
+
+const (
+	sentLogTTL = time.Hour * 24 * 365 * 2 // keep for 2 years
+)
+
+// SentLog records the emails that have been sent, see db.SentEmailTable.
+type SentLog interface {
+	Put(record *db.SentEmailRecord, id string) error
+}
+
+// UseSentLog records every email that is sent in a log, so what was sent to a member can be looked up.
+func (eh *EmailHandler) UseSentLog(sentLog SentLog) {
+	eh.sentLog = sentLog
+}
+
+// About identifies the members and bookings an email is about.
+type About struct {
+	MemberNumbers, SubmissionIds, PaymentReferences []string
+	Event                                           string // tells apart emails of one template about the same bookings
+}
+
+// aboutMembers returns the distinct member numbers, submission IDs and payment references of the members and
+// submissions.
+func aboutMembers(members []*db.MemberRecord, submissions []*db.TrainingSubmission) About {
+	var a About
+	add := func(list *[]string, value string) {
+		if value != "" && !slices.Contains(*list, value) {
+			*list = append(*list, value)
+		}
+	}
+	for _, member := range members {
+		add(&a.MemberNumbers, member.MemberNumber)
+	}
+	for _, submission := range submissions {
+		add(&a.MemberNumbers, submission.MembershipNumber)
+		add(&a.SubmissionIds, submission.GetID())
+		add(&a.PaymentReferences, submission.PaymentReference)
+	}
+	return a
+}
+
+func aboutMember(member *db.MemberRecord, submissions ...*db.TrainingSubmission) About {
+	return aboutMembers([]*db.MemberRecord{member}, submissions)
+}
+
+// logSent records a sent email. The email has gone, so failing to record it is reported but not an error.
+func (eh *EmailHandler) logSent(key string, details db.EmailDetails, messageId string, now time.Time) {
+	if eh.sentLog == nil {
+		return
+	}
+	err := eh.sentLog.Put(&db.SentEmailRecord{
+		EmailDetails: details,
+		SentAt:       now,
+		MessageId:    messageId,
+		ExpireAt:     now.Add(sentLogTTL).Unix(),
+	}, key)
+	if err != nil {
+		fmt.Printf("ERROR: failed to log sent email %s: %v\n", key, err)
+	}
+}
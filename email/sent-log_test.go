@@ -0,0 +1,70 @@
+package email
+
+import (
+	"benjitucker/bathrc-accounts/db"
+	"slices"
+	"testing"
+	"time"
+)
+
+// memSentLog is an in memory SentLog
+type memSentLog struct {
+	records map[string]*db.SentEmailRecord
+}
+
+func (l *memSentLog) Put(record *db.SentEmailRecord, id string) error {
+	record.SetID(id)
+	l.records[id] = record
+	return nil
+}
+
+func TestSentLog(t *testing.T) {
+	transport := &flakyTransport{down: true}
+	eh, _ := newOutboxHandler(t, transport)
+	sentLog := &memSentLog{records: make(map[string]*db.SentEmailRecord)}
+	eh.UseSentLog(sentLog)
+
+	members := []*db.MemberRecord{
+		{MemberNumber: "M100", FirstName: "Jane", Email: "jane@example.com"},
+		{MemberNumber: "M101", FirstName: "John", Email: "john@example.com"},
+	}
+	submissions := []*db.TrainingSubmission{
+		{MembershipNumber: "M100", PaymentReference: "ABCD"},
+		{MembershipNumber: "M101", PaymentReference: "ABCD"},
+	}
+	submissions[0].SetID("sub1")
+	submissions[1].SetID("sub2")
+
+	if err := eh.SendPayReminder(members, submissions); err != nil {
+		t.Fatalf("SendPayReminder returned error: %v", err)
+	}
+	if len(sentLog.records) != 0 {
+		t.Fatalf("expected nothing logged before the email is sent, got %d", len(sentLog.records))
+	}
+
+	transport.down = false
+	if _, err := eh.DrainOutbox(time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("DrainOutbox returned error: %v", err)
+	}
+	if len(sentLog.records) != 1 {
+		t.Fatalf("expected 1 logged email, got %d", len(sentLog.records))
+	}
+
+	for _, record := range sentLog.records {
+		if record.Template != "pay-reminder" || record.MessageId != "msg-id" || record.Subject == "" {
+			t.Errorf("unexpected log entry: %s", record)
+		}
+		if !slices.Equal(record.MemberNumbers, []string{"M100", "M101"}) {
+			t.Errorf("unexpected member numbers %v", record.MemberNumbers)
+		}
+		if !slices.Equal(record.SubmissionIds, []string{"sub1", "sub2"}) {
+			t.Errorf("unexpected submission ids %v", record.SubmissionIds)
+		}
+		if !slices.Equal(record.PaymentReferences, []string{"ABCD"}) {
+			t.Errorf("unexpected payment references %v", record.PaymentReferences)
+		}
+		if !slices.Equal(record.Recipients, []string{"jane@example.com", "john@example.com"}) {
+			t.Errorf("unexpected recipients %v", record.Recipients)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package email
+
+import (
+	"benjitucker/bathrc-accounts/db"
+	"fmt"
+)
+
+type SessionExpiredData struct {
+	FirstName, Venue, TrainingDate, Reference string
+}
+
+// SendSessionExpired tells a member that the session they requested was filled by members who paid first, so their
+// unpaid place has been released.
+func (eh *EmailHandler) SendSessionExpired(member *db.MemberRecord, submission *db.TrainingSubmission) error {
+	if member == nil {
+		fmt.Printf("Cannot send email, no valid membership number to send it to")
+		return nil
+	}
+
+	return eh.SendEmailPretty(memberRecipients(member), aboutMember(member, submission), "session-expired", &SessionExpiredData{
+		FirstName:    member.FirstName,
+		Venue:        submission.Venue,
+		TrainingDate: formatCustomDateTime(submission.TrainingDate),
+		Reference:    submission.PaymentReference,
+	})
+}
@@ -0,0 +1,24 @@
+package email
+
+import (
+	"benjitucker/bathrc-accounts/db"
+	"fmt"
+)
+
+type SessionFullData struct {
+	FirstName, Venue, TrainingDate string
+}
+
+// SendSessionFull tells a member that the session they requested is full and they have been put on the waiting list.
+func (eh *EmailHandler) SendSessionFull(member *db.MemberRecord, submission *db.TrainingSubmission) error {
+	if member == nil {
+		fmt.Printf("Cannot send email, no valid membership number to send it to")
+		return nil
+	}
+
+	return eh.SendEmailPretty(memberRecipients(member), aboutMember(member, submission), "session-full", &SessionFullData{
+		FirstName:    member.FirstName,
+		Venue:        submission.Venue,
+		TrainingDate: formatCustomDateTime(submission.TrainingDate),
+	})
+}
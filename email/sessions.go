@@ -0,0 +1,91 @@
+package email
+
+import (
+	"benjitucker/bathrc-accounts/db"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// SessionData describes one requested training session in an email. Due is the amount still to pay for it when
+// credit or part payments have been taken off, and empty otherwise.
+type SessionData struct {
+	Rider, HorseName, Venue, TrainingDate, Amount, Due string
+}
+
+// sessionList builds the template data for each submission, naming the rider from the matching member record.
+func sessionList(members []*db.MemberRecord, submissions []*db.TrainingSubmission) []SessionData {
+	riders := make(map[string]string)
+	for _, member := range members {
+		riders[member.MemberNumber] = member.FirstName
+	}
+
+	var sessions []SessionData
+	for _, submission := range submissions {
+		session := SessionData{
+			Rider:        riders[submission.MembershipNumber],
+			HorseName:    submission.HorseName,
+			Venue:        submission.Venue,
+			TrainingDate: formatCustomDateTime(submission.TrainingDate),
+			Amount:       formatAmount(submission.AmountPence),
+		}
+		if due := submission.AmountDuePence(); due != submission.AmountPence {
+			session.Due = formatAmount(due)
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions
+}
+
+// recipientsAndNames returns the distinct deliverable email addresses of the members and their first names joined
+// for a greeting, e.g. "Jane, John and Ann".
+func recipientsAndNames(members []*db.MemberRecord) ([]string, string) {
+	var recipients, firstNames []string
+	seen := make(map[string]bool)
+	for _, member := range members {
+		if seen[member.MemberNumber] {
+			continue
+		}
+		seen[member.MemberNumber] = true
+		recipients = append(recipients, memberRecipients(member)...)
+		firstNames = append(firstNames, member.FirstName)
+	}
+	return recipients, joinNames(firstNames)
+}
+
+// memberRecipients returns the member's email address, unless emails to it have bounced.
+func memberRecipients(member *db.MemberRecord) []string {
+	if !member.EmailDeliverable() {
+		fmt.Printf("Not emailing member %s, %q is undeliverable\n", member.MemberNumber, member.Email)
+		return nil
+	}
+	return []string{member.Email}
+}
+
+func joinNames(names []string) string {
+	switch len(names) {
+	case 0:
+		return ""
+	case 1:
+		return names[0]
+	default:
+		return strings.Join(names[:len(names)-1], ", ") + " and " + names[len(names)-1]
+	}
+}
+
+// totalAmountPence is the total still to be paid for the submissions, after any credit has been applied.
+func totalAmountPence(submissions []*db.TrainingSubmission) int64 {
+	var total int64
+	for _, submission := range submissions {
+		total += submission.AmountDuePence()
+	}
+	return total
+}
+
+func earliestPayByDate(submissions []*db.TrainingSubmission) time.Time {
+	var dates []time.Time
+	for _, submission := range submissions {
+		dates = append(dates, submission.PayByDate)
+	}
+	return earliestDate(dates...)
+}
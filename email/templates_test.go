@@ -0,0 +1,212 @@
+package email
+
+import (
+	"benjitucker/bathrc-accounts/db"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRender_MultipleSessions(t *testing.T) {
+	eh, err := NewEmailHandler(context.Background(), nil, HandlerParams{
+		AccountNumber: "12345678",
+		SortCode:      "00-00-00",
+	})
+	if err != nil {
+		t.Fatalf("NewEmailHandler returned error: %v", err)
+	}
+
+	members := []*db.MemberRecord{
+		{MemberNumber: "M1", FirstName: "Jane", Email: "jane@example.com"},
+		{MemberNumber: "M2", FirstName: "John", Email: "john@example.com"},
+		{MemberNumber: "M1", FirstName: "Jane", Email: "jane@example.com"},
+		{MemberNumber: "M3", FirstName: "Ann", Email: "ann@example.com"},
+	}
+	horses := []string{"Star", "Comet", "Breeze", "Storm"}
+	start := time.Date(2026, 5, 1, 19, 0, 0, 0, time.UTC)
+
+	var submissions []*db.TrainingSubmission
+	for i, member := range members {
+		submissions = append(submissions, &db.TrainingSubmission{
+			MembershipNumber: member.MemberNumber,
+			HorseName:        horses[i],
+			Venue:            "Widbrook",
+			TrainingDate:     start.Add(time.Duration(i) * time.Hour),
+			PayByDate:        start.Add(time.Duration(i) * time.Hour).Add(-36 * time.Hour),
+			AmountPence:      2500,
+			PaymentReference: "ABCD",
+		})
+	}
+
+	recipients, firstNames := recipientsAndNames(members)
+	if len(recipients) != 3 {
+		t.Errorf("expected 3 distinct recipients, got %v", recipients)
+	}
+	if firstNames != "Jane, John and Ann" {
+		t.Errorf("firstNames = %q", firstNames)
+	}
+
+	subject, html, text, err := eh.Render("received-request", &ReceivedRequestData{
+		FirstName:     firstNames,
+		Sessions:      sessionList(members, submissions),
+		AccountNumber: "12345678",
+		SortCode:      "00-00-00",
+		Reference:     "ABCD",
+		Amount:        formatAmount(totalAmountPence(submissions)),
+		PayDate:       formatCustomDate(earliestPayByDate(submissions)),
+	})
+	if err != nil {
+		t.Fatalf("Render returned error: %v", err)
+	}
+
+	if subject != "Training Sessions Request Received - Awaiting Payment" {
+		t.Errorf("subject = %q", subject)
+	}
+	for _, horse := range horses {
+		if !strings.Contains(text, horse) || !strings.Contains(html, horse) {
+			t.Errorf("missing session riding %s", horse)
+		}
+	}
+	if !strings.Contains(text, "£100.00") {
+		t.Errorf("missing total amount: %s", text)
+	}
+	if !strings.Contains(text, "Ann riding Storm") {
+		t.Errorf("missing rider name: %s", text)
+	}
+	if strings.Contains(text, "to pay after credit") {
+		t.Errorf("unexpected amount due on a session with nothing taken off: %s", text)
+	}
+
+	// The sessions add up to the total when credit and part payments have been taken off
+	submissions[0].CreditAppliedPence = 500
+	submissions[1].Allocations = []db.PaymentAllocation{{TransactionId: "T1", AmountPence: 1000}}
+	_, html, text, err = eh.Render("pay-reminder", &PayReminderData{
+		FirstName: firstNames,
+		Sessions:  sessionList(members, submissions),
+		Reference: "ABCD",
+		Amount:    formatAmount(totalAmountPence(submissions)),
+	})
+	if err != nil {
+		t.Fatalf("Render returned error: %v", err)
+	}
+	for _, want := range []string{"Star, £25.00 (£20.00 to pay after credit and payments received)",
+		"Comet, £25.00 (£15.00 to pay after credit and payments received)", "Amount:            £85.00"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("missing %q: %s", want, text)
+		}
+	}
+	if !strings.Contains(html, "£15.00 to pay") {
+		t.Errorf("missing amount due in html: %s", html)
+	}
+}
+
+func TestRender_ReceivedPaymentProblems(t *testing.T) {
+	eh, err := NewEmailHandler(context.Background(), nil, HandlerParams{})
+	if err != nil {
+		t.Fatalf("NewEmailHandler returned error: %v", err)
+	}
+
+	sessions := []SessionData{{Venue: "Widbrook", TrainingDate: "Friday 1st May at 7:00 PM", Amount: "25.00"}}
+
+	subject, _, text, err := eh.Render("received-payment", &ReceivedPaymentData{
+		FirstName:    "Jane",
+		Sessions:     sessions,
+		ProblemTexts: []string{"first problem", "second problem", "third problem"},
+	})
+	if err != nil {
+		t.Fatalf("Render returned error: %v", err)
+	}
+
+	if subject != "Training Session Payment Received" {
+		t.Errorf("subject = %q", subject)
+	}
+	for _, problem := range []string{"first problem", "second problem", "third problem"} {
+		if !strings.Contains(text, problem) {
+			t.Errorf("missing %q: %s", problem, text)
+		}
+	}
+
+	_, _, text, err = eh.Render("received-payment", &ReceivedPaymentData{FirstName: "Jane", Sessions: sessions})
+	if err != nil {
+		t.Fatalf("Render returned error: %v", err)
+	}
+	if strings.Contains(text, "Please note") {
+		t.Errorf("unexpected problem section: %s", text)
+	}
+}
+
+func TestRender_ReconciliationReport(t *testing.T) {
+	eh, err := NewEmailHandler(context.Background(), nil, HandlerParams{})
+	if err != nil {
+		t.Fatalf("NewEmailHandler returned error: %v", err)
+	}
+
+	subject, html, text, err := eh.Render("reconciliation-report", &ReconciliationReportData{
+		Date:              "Friday 1st May",
+		UnmatchedPayments: 1,
+		OverdueBookings:   2,
+		Discrepancies:     1,
+		NearMisses:        0,
+	})
+	if err != nil {
+		t.Fatalf("Render returned error: %v", err)
+	}
+
+	if subject != "Payment reconciliation exceptions for Friday 1st May" {
+		t.Errorf("subject = %q", subject)
+	}
+	for _, want := range []string{"1 payment not linked", "2 unpaid bookings", "1 payment discrepancy", "0 near misses"} {
+		if !strings.Contains(text, want) || !strings.Contains(html, want) {
+			t.Errorf("missing %q in %s", want, text)
+		}
+	}
+	if attachmentContentType("report.CSV") != "text/csv" {
+		t.Errorf("unexpected CSV content type %q", attachmentContentType("report.CSV"))
+	}
+}
+
+func TestRender_MembershipExpiry(t *testing.T) {
+	eh, err := NewEmailHandler(context.Background(), nil, HandlerParams{})
+	if err != nil {
+		t.Fatalf("NewEmailHandler returned error: %v", err)
+	}
+
+	member := &db.MemberRecord{MemberNumber: "M1", FirstName: "Jane", Email: "jane@example.com"}
+	submissions := []*db.TrainingSubmission{
+		{MembershipNumber: "M1", HorseName: "Star", Venue: "Widbrook",
+			TrainingDate: time.Date(2026, 4, 2, 19, 0, 0, 0, time.UTC)},
+		{MembershipNumber: "M1", HorseName: "Star", Venue: "Widbrook",
+			TrainingDate: time.Date(2026, 4, 9, 19, 0, 0, 0, time.UTC)},
+	}
+
+	subject, html, text, err := eh.Render("membership-expiry", &MembershipExpiryData{
+		FirstName:    member.FirstName,
+		MemberNumber: member.MemberNumber,
+		ExpiryDate:   formatCustomDate(time.Date(2026, 3, 31, 0, 0, 0, 0, time.UTC)),
+		Sessions:     sessionList([]*db.MemberRecord{member}, submissions),
+	})
+	if err != nil {
+		t.Fatalf("Render returned error: %v", err)
+	}
+	if subject != "Bath Riding Club Membership - Renew Before Your Training" {
+		t.Errorf("subject = %q", subject)
+	}
+	for _, want := range []string{"Tuesday 31st March", "following training sessions", "Widbrook"} {
+		if !strings.Contains(text, want) || !strings.Contains(html, want) {
+			t.Errorf("missing %q", want)
+		}
+	}
+
+	subject, _, text, err = eh.Render("renewal-reminder", &RenewalReminderData{
+		FirstName:    member.FirstName,
+		MemberNumber: member.MemberNumber,
+		ExpiryDate:   "Tuesday 31st March",
+	})
+	if err != nil {
+		t.Fatalf("Render returned error: %v", err)
+	}
+	if subject != "Bath Riding Club Membership - Renewal Due" || !strings.Contains(text, "expires on Tuesday 31st March") {
+		t.Errorf("unexpected renewal reminder %q: %s", subject, text)
+	}
+}
@@ -0,0 +1,104 @@
+package email
+
+import (
+	"context"
+	"fmt"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ses"
+	"github.com/aws/aws-sdk-go-v2/service/ses/types"
+)
+
+// Transport delivers a complete MIME message to the envelope recipients, which include any Bcc recipients not named
+// in the message headers. It returns an ID for the message.
+type Transport interface {
+	Send(ctx context.Context, from string, recipients []string, raw []byte) (string, error)
+}
+
+// NewTransport creates the transport described by spec: "ses" (or empty) for AWS SES, "smtp:<host>:<port>" for a plain
+// SMTP server such as a local mail catcher, or "file:<dir>" to save each message as a .eml file in a directory.
+func NewTransport(spec string, sesClient *ses.Client) (Transport, error) {
+	kind, arg, _ := strings.Cut(spec, ":")
+	switch kind {
+	case "", "ses":
+		return &SESTransport{Client: sesClient}, nil
+	case "smtp":
+		if arg == "" {
+			return nil, fmt.Errorf("invalid email transport %q, missing SMTP address", spec)
+		}
+		return &SMTPTransport{Addr: arg}, nil
+	case "file":
+		if arg == "" {
+			return nil, fmt.Errorf("invalid email transport %q, missing directory", spec)
+		}
+		return &FileTransport{Dir: arg}, nil
+	default:
+		return nil, fmt.Errorf("unknown email transport %q", spec)
+	}
+}
+
+// SESTransport sends messages with AWS SES.
+type SESTransport struct {
+	Client *ses.Client
+}
+
+func (t *SESTransport) Send(ctx context.Context, from string, recipients []string, raw []byte) (string, error) {
+	result, err := t.Client.SendRawEmail(ctx, &ses.SendRawEmailInput{
+		Source:       aws.String(from),
+		Destinations: recipients,
+		RawMessage: &types.RawMessage{
+			Data: raw,
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	return aws.ToString(result.MessageId), nil
+}
+
+// SMTPTransport sends messages to an SMTP server, without authentication unless Auth is set.
+type SMTPTransport struct {
+	Addr string
+	Auth smtp.Auth
+}
+
+func (t *SMTPTransport) Send(_ context.Context, from string, recipients []string, raw []byte) (string, error) {
+	err := smtp.SendMail(t.Addr, t.Auth, from, recipients, raw)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("smtp-%d", time.Now().UnixNano()), nil
+}
+
+// FileTransport saves each message as a .eml file in a directory instead of sending it. The envelope recipients are
+// added to the message as an X-Envelope-To header, so Bcc recipients can be checked.
+type FileTransport struct {
+	Dir string
+
+	mu    sync.Mutex
+	count int
+}
+
+func (t *FileTransport) Send(_ context.Context, _ string, recipients []string, raw []byte) (string, error) {
+	if err := os.MkdirAll(t.Dir, 0o755); err != nil {
+		return "", err
+	}
+
+	t.mu.Lock()
+	t.count++
+	id := fmt.Sprintf("%s-%04d", time.Now().UTC().Format("20060102T150405.000000000"), t.count)
+	t.mu.Unlock()
+
+	data := append([]byte("X-Envelope-To: "+strings.Join(recipients, ", ")+"\r\n"), raw...)
+	err := os.WriteFile(filepath.Join(t.Dir, id+".eml"), data, 0o644)
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
@@ -0,0 +1,143 @@
+package email
+
+import (
+	"benjitucker/bathrc-accounts/db"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// readMessages reads the messages saved by a FileTransport, oldest first.
+func readMessages(t *testing.T, dir string) []*mail.Message {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var messages []*mail.Message
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		message, err := mail.ReadMessage(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("invalid message %s: %v", file, err)
+		}
+		messages = append(messages, message)
+	}
+	return messages
+}
+
+func TestFileTransport(t *testing.T) {
+	dir := t.TempDir()
+	transport, err := NewTransport("file:"+dir, nil)
+	if err != nil {
+		t.Fatalf("NewTransport returned error: %v", err)
+	}
+
+	eh, err := NewEmailHandler(context.Background(), transport, HandlerParams{
+		MonitorEmail:  "monitor@example.com",
+		ClubEmail:     "club@example.com",
+		TrainingEmail: "training@example.com",
+	})
+	if err != nil {
+		t.Fatalf("NewEmailHandler returned error: %v", err)
+	}
+
+	if err := eh.SendEmail("admin@example.com", "Uploaded £10", "hello"); err != nil {
+		t.Fatalf("SendEmail returned error: %v", err)
+	}
+	err = eh.SendSessionExpired(&db.MemberRecord{FirstName: "Jane", Email: "jane@example.com"},
+		&db.TrainingSubmission{Venue: "Widbrook", PaymentReference: "ABCD"})
+	if err != nil {
+		t.Fatalf("SendSessionExpired returned error: %v", err)
+	}
+
+	messages := readMessages(t, dir)
+	if len(messages) != 2 {
+		t.Fatalf("expected 2 messages, got %d", len(messages))
+	}
+
+	plain := messages[0]
+	if subject, _ := new(mime.WordDecoder).DecodeHeader(plain.Header.Get("Subject")); subject != "Uploaded £10" {
+		t.Errorf("subject = %q", subject)
+	}
+	if got := plain.Header.Get("X-Envelope-To"); got != "admin@example.com, monitor@example.com" {
+		t.Errorf("envelope = %q", got)
+	}
+	if plain.Header.Get("Bcc") != "" {
+		t.Errorf("the monitor email should not be in the headers")
+	}
+	if body, _ := io.ReadAll(plain.Body); strings.TrimSpace(string(body)) != "hello" {
+		t.Errorf("body = %q", body)
+	}
+
+	pretty := messages[1]
+	if pretty.Header.Get("To") != "jane@example.com" || pretty.Header.Get("From") != "training@example.com" {
+		t.Errorf("unexpected headers %v", pretty.Header)
+	}
+	if got := pretty.Header.Get("X-Envelope-To"); got != "jane@example.com, monitor@example.com" {
+		t.Errorf("envelope = %q", got)
+	}
+	if body, _ := io.ReadAll(pretty.Body); !strings.Contains(string(body), "Your place has been released") {
+		t.Errorf("missing body text")
+	}
+}
+
+type failingTransport struct{}
+
+func (failingTransport) Send(context.Context, string, []string, []byte) (string, error) {
+	return "", errors.New("throttled")
+}
+
+func TestSendErrors(t *testing.T) {
+	eh, err := NewEmailHandler(context.Background(), failingTransport{}, HandlerParams{})
+	if err != nil {
+		t.Fatalf("NewEmailHandler returned error: %v", err)
+	}
+
+	if err := eh.SendEmail("admin@example.com", "subject", "body"); err == nil ||
+		!strings.Contains(err.Error(), "throttled") {
+		t.Errorf("expected the transport error, got %v", err)
+	}
+	member := &db.MemberRecord{FirstName: "Jane", Email: "jane@example.com"}
+	if err := eh.SendSessionFull(member, &db.TrainingSubmission{}); err == nil {
+		t.Errorf("expected the transport error")
+	}
+	if err := eh.SendEmailPretty([]string{member.Email}, About{}, "no-such-template", nil); err == nil ||
+		!strings.Contains(err.Error(), "not found") {
+		t.Errorf("expected a render error, got %v", err)
+	}
+}
+
+func TestNewTransport(t *testing.T) {
+	for spec, want := range map[string]string{
+		"":                    "*email.SESTransport",
+		"ses":                 "*email.SESTransport",
+		"smtp:localhost:1025": "*email.SMTPTransport",
+		"file:/tmp/mail":      "*email.FileTransport",
+	} {
+		transport, err := NewTransport(spec, nil)
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", spec, err)
+			continue
+		}
+		if got := fmt.Sprintf("%T", transport); got != want {
+			t.Errorf("%q: got %s, want %s", spec, got, want)
+		}
+	}
+	for _, spec := range []string{"smtp", "file:", "pigeon"} {
+		if _, err := NewTransport(spec, nil); err == nil {
+			t.Errorf("%q: expected error", spec)
+		}
+	}
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"benjitucker/bathrc-accounts/db"
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	creditRecordTTL = time.Hour * 24 * 365 * 2 // keep for 2 years
+)
+
+// memberBalance is the outstanding ledger balance for a member, positive when the club owes the member.
+type memberBalance struct {
+	MemberNumber string
+	Name         string
+	BalancePence int64
+}
+
+func newCreditRecord(kind, memberNumber string, amountPence int64) *db.CreditRecord {
+	now := time.Now()
+	return &db.CreditRecord{
+		MemberNumber: memberNumber,
+		Date:         now,
+		ExpireAt:     now.Add(creditRecordTTL).Unix(),
+		Kind:         kind,
+		AmountPence:  amountPence,
+	}
+}
+
+func submissionIds(submissions []*db.TrainingSubmission) []string {
+	var ids []string
+	for _, submission := range submissions {
+		ids = append(ids, submission.GetID())
+	}
+	return ids
+}
+
+// recordPaymentDiscrepancy records the difference between a payment and the amount due for the submissions it paid
+// for against the member of the first submission.
+func recordPaymentDiscrepancy(transaction *db.TransactionRecord, submissions []*db.TrainingSubmission,
+	amountDuePence int64) error {
+
+	difference := transaction.AmountPence - amountDuePence
+	if difference == 0 || len(submissions) == 0 {
+		return nil
+	}
+
+	kind := db.OverpaymentCreditKind
+	if difference < 0 {
+		kind = db.UnderpaymentCreditKind
+	}
+
+	memberNumber := submissions[0].MembershipNumber
+	record := newCreditRecord(kind, memberNumber, difference)
+	record.TransactionId = transaction.GetID()
+	record.SubmissionIds = submissionIds(submissions)
+	record.PaymentReference = submissions[0].PaymentReference
+	record.Note = fmt.Sprintf("paid %s, due %s", formatAmount(transaction.AmountPence), formatAmount(amountDuePence))
+
+	return creditTable.Put(record, db.MakeCreditId(kind, memberNumber, transaction.GetID()))
+}
+
+// recordCancellationCredit records the refund or credit due to a member for a cancelled paid submission.
+func recordCancellationCredit(submission *db.TrainingSubmission) error {
+	record := newCreditRecord(db.CancellationCreditKind, submission.MembershipNumber,
+		cancellationCreditPence(submission))
+	record.TransactionId = submission.PaymentRecordId
+	record.SubmissionIds = []string{submission.GetID()}
+	record.PaymentReference = submission.PaymentReference
+	record.Note = fmt.Sprintf("cancelled %s session on %s", submission.Venue,
+		submission.TrainingDate.Format(time.RFC1123))
+
+	return creditTable.Put(record,
+		db.MakeCreditId(db.CancellationCreditKind, submission.MembershipNumber, submission.GetID()))
+}
+
+// cancellationCreditPence is what a member has paid for a submission, in payments and credit, and is owed when it is
+// cancelled in time. A part paid submission has only been paid for in part.
+func cancellationCreditPence(submission *db.TrainingSubmission) int64 {
+	if submission.PaymentRecordId != "" {
+		return submission.AmountPence
+	}
+	return submission.CreditAppliedPence + submission.AmountPaidPence()
+}
+
+// returnAppliedCredit gives back any credit and part payments that were used towards an unpaid submission that will
+// no longer be paid for, e.g. one that has been cancelled or whose place has been given to someone else.
+func returnAppliedCredit(submission *db.TrainingSubmission) error {
+	amount := submission.CreditAppliedPence + submission.AmountPaidPence()
+	if amount == 0 || submission.PaymentRecordId != "" {
+		return nil
+	}
+
+	record := newCreditRecord(db.CancellationCreditKind, submission.MembershipNumber, amount)
+	record.SubmissionIds = []string{submission.GetID()}
+	record.PaymentReference = submission.PaymentReference
+	record.Note = fmt.Sprintf("credit and part payments returned from unpaid %s session on %s", submission.Venue,
+		submission.TrainingDate.Format(time.RFC1123))
+
+	return creditTable.Put(record,
+		db.MakeCreditId(db.CancellationCreditKind, submission.MembershipNumber, submission.GetID()))
+}
+
+// newRefundRecord records a refund paid to a member out of the credit they hold, reducing what the club owes them.
+// The refund is the payment out of the club account, a negative amount.
+func newRefundRecord(transaction *db.TransactionRecord, memberNumber string, balancePence int64) (*db.CreditRecord,
+	error) {
+
+	if transaction.AmountPence >= 0 {
+		return nil, fmt.Errorf("transaction %s is not a payment out so cannot be a refund", transaction.GetID())
+	}
+	if -transaction.AmountPence > balancePence {
+		return nil, fmt.Errorf("refund of %s to member %s is more than the %s credit they hold",
+			formatAmount(-transaction.AmountPence), memberNumber, formatAmount(balancePence))
+	}
+
+	record := newCreditRecord(db.RefundedCreditKind, memberNumber, transaction.AmountPence)
+	record.TransactionId = transaction.GetID()
+	record.Note = fmt.Sprintf("refunded %s", formatAmount(-transaction.AmountPence))
+	return record, nil
+}
+
+// refundCredit records a refund of credit to a member, so it no longer shows as owed to them.
+func refundCredit(transaction *db.TransactionRecord, memberNumber string) error {
+	id := db.MakeCreditId(db.RefundedCreditKind, memberNumber, transaction.GetID())
+	existing, err := creditTable.Get(id)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return fmt.Errorf("refund %s to member %s has already been recorded", transaction.GetID(), memberNumber)
+	}
+
+	records, err := creditTable.GetAllForMember(memberNumber)
+	if err != nil {
+		return err
+	}
+	record, err := newRefundRecord(transaction, memberNumber, db.Balance(records))
+	if err != nil {
+		return err
+	}
+
+	err = creditTable.Put(record, id)
+	if err != nil {
+		return err
+	}
+
+	return emailHandler.SendEmail(testEmail, "Training: Credit refunded",
+		fmt.Sprintf("Refund %s recorded for member %s, %s credit left", transaction.String(), memberNumber,
+			formatAmount(db.Balance(records)+transaction.AmountPence)))
+}
+
+// allocateCredit uses the members' available credit towards the amount due for the submissions, in submission
+// order, setting CreditAppliedPence on each. It returns the credit used from each member.
+func allocateCredit(submissions []*db.TrainingSubmission, available map[string]int64) map[string]int64 {
+	used := make(map[string]int64)
+	for _, submission := range submissions {
+		due := submission.AmountDuePence()
+		// Use the rider's own credit first, then that of the others in the set
+		var memberNumbers []string
+		memberNumbers = append(memberNumbers, submission.MembershipNumber)
+		for _, other := range submissions {
+			if other.MembershipNumber != submission.MembershipNumber {
+				memberNumbers = append(memberNumbers, other.MembershipNumber)
+			}
+		}
+		for _, memberNumber := range memberNumbers {
+			if due <= 0 {
+				break
+			}
+			credit := available[memberNumber] - used[memberNumber]
+			if credit <= 0 {
+				continue
+			}
+			apply := min(credit, due)
+			used[memberNumber] += apply
+			submission.CreditAppliedPence += apply
+			due -= apply
+		}
+	}
+	return used
+}
+
+// applyCredit uses any credit held by the members of a submission set towards its cost and records the credit used.
+// Submissions that are fully paid by credit are marked as paid. It returns the total credit used.
+func applyCredit(submissions []*db.TrainingSubmission) (int64, error) {
+	available := make(map[string]int64)
+	for _, submission := range submissions {
+		if _, ok := available[submission.MembershipNumber]; ok {
+			continue
+		}
+		records, err := creditTable.GetAllForMember(submission.MembershipNumber)
+		if err != nil {
+			return 0, err
+		}
+		available[submission.MembershipNumber] = db.Balance(records)
+	}
+
+	used := allocateCredit(submissions, available)
+
+	var total int64
+	var consumedId string
+	for memberNumber, amount := range used {
+		if amount == 0 {
+			continue
+		}
+		id := db.MakeCreditId(db.ConsumedCreditKind, memberNumber, submissions[0].GetID())
+		record, err := creditTable.Get(id)
+		if err != nil {
+			return 0, err
+		}
+		if record != nil {
+			// credit applied to the set before, CreditAppliedPence on the submissions includes both
+			record.AmountPence -= amount
+		} else {
+			record = newCreditRecord(db.ConsumedCreditKind, memberNumber, -amount)
+		}
+		record.SubmissionIds = submissionIds(submissions)
+		record.PaymentReference = submissions[0].PaymentReference
+		err = creditTable.Put(record, id)
+		if err != nil {
+			return 0, err
+		}
+		total += amount
+		consumedId = id
+	}
+
+	if total == 0 {
+		return 0, nil
+	}
+
+	var due int64
+	for _, submission := range submissions {
+		due += submission.AmountDuePence()
+	}
+	if due == 0 {
+		// Paid in full from credit, the credit record stands in for the payment
+		for _, submission := range submissions {
+			submission.SubmissionState = db.PaidSubmissionState
+			submission.PaymentRecordId = consumedId
+		}
+	}
+
+	return total, nil
+}
+
+// sendReceivedRequest applies any available credit to a submission set, emails the members either the payment
+// details for the remainder or confirmation that credit has paid for it, and stores the submissions. The submissions
+// are only marked as emailed once the email has been sent.
+func sendReceivedRequest(members []*db.MemberRecord, submissions []*db.TrainingSubmission, extraText string) error {
+	creditUsed, err := applyCredit(submissions)
+	if err != nil {
+		return err
+	}
+
+	if creditUsed > 0 {
+		// store the credit used before the email, so it is kept if the email fails
+		err = trainTable.PutAll(submissions)
+		if err != nil {
+			return err
+		}
+	}
+
+	if creditUsed > 0 && submissions[0].SubmissionState == db.PaidSubmissionState {
+		err = emailHandler.SendReceivedPayment(members, submissions, []string{fmt.Sprintf(
+			`The sessions have been paid for using %s of credit held with the club.`, formatAmount(creditUsed))})
+	} else {
+		if creditUsed > 0 {
+			extraText = fmt.Sprintf("%s %s of credit held with the club has been used towards the cost.",
+				extraText, formatAmount(creditUsed))
+		}
+		err = emailHandler.SendReceivedRequest(members, submissions, extraText)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, submission := range submissions {
+		submission.ReceivedRequestEmailSent = true
+	}
+	return trainTable.PutAll(submissions)
+}
+
+// outstandingBalances sums the ledger entries by member, returning the members with a non-zero balance sorted by
+// member number.
+func outstandingBalances(records []*db.CreditRecord,
+	getMember func(id string) (*db.MemberRecord, error)) ([]*memberBalance, error) {
+
+	byMember := make(map[string]int64)
+	for _, record := range records {
+		byMember[record.MemberNumber] += record.AmountPence
+	}
+
+	var balances []*memberBalance
+	for memberNumber, balance := range byMember {
+		if balance == 0 {
+			continue
+		}
+		name := ""
+		member, err := getMember(memberNumber)
+		if err != nil {
+			return nil, err
+		}
+		if member != nil {
+			name = member.FirstName + " " + member.LastName
+		}
+		balances = append(balances, &memberBalance{
+			MemberNumber: memberNumber,
+			Name:         name,
+			BalancePence: balance,
+		})
+	}
+
+	sort.Slice(balances, func(i, j int) bool {
+		return balances[i].MemberNumber < balances[j].MemberNumber
+	})
+	return balances, nil
+}
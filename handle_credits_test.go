@@ -0,0 +1,184 @@
+package main
+
+import (
+	"benjitucker/bathrc-accounts/db"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newCreditTestSubmission(id, memberNumber string, amountPence int64) *db.TrainingSubmission {
+	sub := &db.TrainingSubmission{MembershipNumber: memberNumber, AmountPence: amountPence}
+	sub.SetID(id)
+	return sub
+}
+
+func TestAllocateCredit(t *testing.T) {
+	tests := []struct {
+		name        string
+		submissions []*db.TrainingSubmission
+		available   map[string]int64
+		wantUsed    map[string]int64
+		wantApplied []int64
+	}{
+		{
+			name: "no credit",
+			submissions: []*db.TrainingSubmission{
+				newCreditTestSubmission("1-0", "M1", 2500),
+			},
+			available:   map[string]int64{},
+			wantUsed:    map[string]int64{},
+			wantApplied: []int64{0},
+		},
+		{
+			name: "credit covers the set",
+			submissions: []*db.TrainingSubmission{
+				newCreditTestSubmission("1-0", "M1", 2500),
+			},
+			available:   map[string]int64{"M1": 4000},
+			wantUsed:    map[string]int64{"M1": 2500},
+			wantApplied: []int64{2500},
+		},
+		{
+			name: "partial credit",
+			submissions: []*db.TrainingSubmission{
+				newCreditTestSubmission("1-0", "M1", 2500),
+				newCreditTestSubmission("1-1", "M1", 2500),
+			},
+			available:   map[string]int64{"M1": 3000},
+			wantUsed:    map[string]int64{"M1": 3000},
+			wantApplied: []int64{2500, 500},
+		},
+		{
+			name: "another member's credit used for the set",
+			submissions: []*db.TrainingSubmission{
+				newCreditTestSubmission("1-0", "M1", 2500),
+				newCreditTestSubmission("1-1", "M2", 2500),
+			},
+			available:   map[string]int64{"M1": 4000},
+			wantUsed:    map[string]int64{"M1": 4000},
+			wantApplied: []int64{2500, 1500},
+		},
+		{
+			name: "money owed to the club is not used",
+			submissions: []*db.TrainingSubmission{
+				newCreditTestSubmission("1-0", "M1", 2500),
+			},
+			available:   map[string]int64{"M1": -500},
+			wantUsed:    map[string]int64{},
+			wantApplied: []int64{0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			used := allocateCredit(tt.submissions, tt.available)
+			for memberNumber, want := range tt.wantUsed {
+				if used[memberNumber] != want {
+					t.Errorf("used[%s] = %d, want %d", memberNumber, used[memberNumber], want)
+				}
+			}
+			for memberNumber, got := range used {
+				if _, ok := tt.wantUsed[memberNumber]; !ok && got != 0 {
+					t.Errorf("unexpected credit used from %s: %d", memberNumber, got)
+				}
+			}
+			for i, submission := range tt.submissions {
+				if submission.CreditAppliedPence != tt.wantApplied[i] {
+					t.Errorf("submission %d credit applied = %d, want %d",
+						i, submission.CreditAppliedPence, tt.wantApplied[i])
+				}
+				if submission.AmountDuePence() != submission.AmountPence-tt.wantApplied[i] {
+					t.Errorf("submission %d amount due = %d", i, submission.AmountDuePence())
+				}
+			}
+		})
+	}
+}
+
+func TestOutstandingBalances(t *testing.T) {
+	records := []*db.CreditRecord{
+		{MemberNumber: "M2", AmountPence: 500},
+		{MemberNumber: "M1", AmountPence: 2500},
+		{MemberNumber: "M1", AmountPence: -1000},
+		{MemberNumber: "M3", AmountPence: 2500},
+		{MemberNumber: "M3", AmountPence: -2500},
+	}
+	members := map[string]*db.MemberRecord{
+		"M1": {FirstName: "Jane", LastName: "Smith"},
+	}
+
+	balances, err := outstandingBalances(records, func(id string) (*db.MemberRecord, error) {
+		return members[id], nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(balances) != 2 {
+		t.Fatalf("expected 2 balances, got %d", len(balances))
+	}
+	if balances[0].MemberNumber != "M1" || balances[0].Name != "Jane Smith" || balances[0].BalancePence != 1500 {
+		t.Errorf("unexpected first balance %+v", balances[0])
+	}
+	if balances[1].MemberNumber != "M2" || balances[1].Name != "" || balances[1].BalancePence != 500 {
+		t.Errorf("unexpected second balance %+v", balances[1])
+	}
+
+	_, err = outstandingBalances(records, func(id string) (*db.MemberRecord, error) {
+		return nil, errors.New("lookup failed")
+	})
+	if err == nil {
+		t.Errorf("expected member lookup error")
+	}
+}
+
+func TestWriteEmailBalances(t *testing.T) {
+	twoMonthsAgo := time.Now().AddDate(0, -2, 0)
+	balances := []*memberBalance{
+		{MemberNumber: "M1", Name: "Jane Smith", BalancePence: 1500},
+	}
+
+	var gotBody string
+	err := writeEmail(nil, nil, balances, twoMonthsAgo, func(subject, body string) error {
+		gotBody = body
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(gotBody, "Outstanding member balances") {
+		t.Fatalf("expected balances section, got %q", gotBody)
+	}
+	if !strings.Contains(gotBody, "M1,Jane Smith,"+formatPounds(1500)) {
+		t.Errorf("expected balance line for M1, got %q", gotBody)
+	}
+}
+
+func TestNewRefundRecord(t *testing.T) {
+	refund := &db.TransactionRecord{AmountPence: -1500, Type: "DR"}
+	refund.SetID("T9")
+
+	record, err := newRefundRecord(refund, "M1", 2000)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if record.Kind != db.RefundedCreditKind || record.AmountPence != -1500 || record.TransactionId != "T9" {
+		t.Errorf("unexpected refund record %s", record)
+	}
+	if balance := db.Balance([]*db.CreditRecord{{AmountPence: 2000}, record}); balance != 500 {
+		t.Errorf("expected £5 left owed after the refund, got %d", balance)
+	}
+
+	if _, err := newRefundRecord(refund, "M1", 1000); err == nil {
+		t.Errorf("expected an error refunding more than the credit held")
+	}
+
+	payment := &db.TransactionRecord{AmountPence: 1500, Type: "CR"}
+	payment.SetID("T1")
+	if _, err := newRefundRecord(payment, "M1", 2000); err == nil {
+		t.Errorf("expected an error for a payment in")
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"benjitucker/bathrc-accounts/db"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// handleEmailLookup emails the admin the emails that have been sent, or are waiting to be sent, about a member
+// number or payment reference.
+func handleEmailLookup(memberNumberOrReference string) error {
+	memberNumberOrReference = strings.TrimSpace(memberNumberOrReference)
+
+	sent, err := sentEmailTable.GetAllAbout(memberNumberOrReference)
+	if err != nil {
+		return err
+	}
+	queued, err := outboxTable.GetAllAbout(memberNumberOrReference)
+	if err != nil {
+		return err
+	}
+
+	return emailHandler.SendEmail(testEmail, "Emails about "+memberNumberOrReference,
+		emailLookupReport(memberNumberOrReference, sent, queued))
+}
+
+// emailLookupReport lists the sent emails, newest first, followed by the queued emails that have not been sent.
+func emailLookupReport(memberNumberOrReference string, sent []*db.SentEmailRecord,
+	queued []*db.OutboxMessage) string {
+
+	sort.Slice(sent, func(i, j int) bool {
+		return sent[i].SentAt.After(sent[j].SentAt)
+	})
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d emails sent about %s\n\n", len(sent), memberNumberOrReference)
+	for _, record := range sent {
+		sb.WriteString(record.String() + "\n")
+	}
+
+	var unsent []*db.OutboxMessage
+	for _, message := range queued {
+		if message.Status != db.SentOutboxStatus {
+			unsent = append(unsent, message)
+		}
+	}
+	if len(unsent) > 0 {
+		sort.Slice(unsent, func(i, j int) bool {
+			return unsent[i].Created.After(unsent[j].Created)
+		})
+		fmt.Fprintf(&sb, "\n%d emails not sent\n\n", len(unsent))
+		for _, message := range unsent {
+			sb.WriteString(message.String() + "\n")
+		}
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"benjitucker/bathrc-accounts/db"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEmailLookupReport(t *testing.T) {
+	day := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+
+	sent := []*db.SentEmailRecord{
+		{
+			EmailDetails: db.EmailDetails{Template: "received-request", Recipients: []string{"jane@example.com"},
+				MemberNumbers: []string{"M100"}, PaymentReferences: []string{"ABCD"}},
+			SentAt:    day,
+			MessageId: "msg-1",
+		},
+		{
+			EmailDetails: db.EmailDetails{Template: "pay-reminder", Recipients: []string{"jane@example.com"},
+				MemberNumbers: []string{"M100"}, PaymentReferences: []string{"ABCD"}},
+			SentAt:    day.Add(24 * time.Hour),
+			MessageId: "msg-2",
+		},
+	}
+	queued := []*db.OutboxMessage{
+		{
+			EmailDetails: db.EmailDetails{Template: "received-request"},
+			Status:       db.SentOutboxStatus,
+			Created:      day,
+		},
+		{
+			EmailDetails: db.EmailDetails{Template: "confirm"},
+			Status:       db.PendingOutboxStatus,
+			Created:      day.Add(48 * time.Hour),
+			Attempts:     2,
+			LastError:    "throttled",
+		},
+	}
+
+	report := emailLookupReport("M100", sent, queued)
+	lines := strings.Split(strings.TrimSpace(report), "\n")
+
+	if lines[0] != "2 emails sent about M100" {
+		t.Errorf("unexpected heading %q", lines[0])
+	}
+	if !strings.Contains(lines[2], "pay-reminder") || !strings.Contains(lines[2], "msg-2") {
+		t.Errorf("expected the newest email first, got %q", lines[2])
+	}
+	if !strings.Contains(lines[3], "received-request") {
+		t.Errorf("expected the older email second, got %q", lines[3])
+	}
+	if !strings.Contains(report, "1 emails not sent") {
+		t.Errorf("expected the pending email to be reported, got\n%s", report)
+	}
+	if !strings.Contains(report, "confirm") || !strings.Contains(report, "throttled") {
+		t.Errorf("expected the pending email details, got\n%s", report)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"benjitucker/bathrc-accounts/db"
+	"fmt"
+)
+
+// findLatePayers returns the unpaid submissions for sessions whose places have all been taken by paid submissions. A
+// part paid submission is not a late payer, its place is kept while the rest is paid.
+func findLatePayers(received, paid []*db.TrainingSubmission) []*db.TrainingSubmission {
+	paidCount := make(map[sessionKey]int)
+	for _, submission := range paid {
+		paidCount[sessionKeyOf(submission)]++
+	}
+
+	var late []*db.TrainingSubmission
+	for _, submission := range received {
+		if submission.PaymentReceived() {
+			continue
+		}
+		if paidCount[sessionKeyOf(submission)] >= sessionCapacity(submission.Venue, submission.TrainingDate) {
+			late = append(late, submission)
+		}
+	}
+	return late
+}
+
+// handleLatePayers expires unpaid submissions for sessions that have been filled by paid submissions and tells the
+// members they were too late. The expired submissions are removed from their linked sets so the rest of the set can
+// still be paid for. It returns the received submissions that remain and those that were expired.
+func handleLatePayers(received, paid []*db.TrainingSubmission) (
+	remaining, expired []*db.TrainingSubmission, err error) {
+
+	expired = findLatePayers(received, paid)
+	if len(expired) == 0 {
+		return received, nil, nil
+	}
+
+	for _, submission := range expired {
+		fmt.Printf("expiring unpaid submission id %s, session filled by paid submissions\n", submission.GetID())
+
+		err = unlinkSubmission(submission, received)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		err = returnAppliedCredit(submission)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		submission.SubmissionState = db.ExpiredSubmissionState
+		err = trainTable.Put(submission, submission.GetID())
+		if err != nil {
+			return nil, nil, err
+		}
+
+		member, err := memberTable.Get(submission.MembershipNumber)
+		if err != nil || member == nil {
+			continue
+		}
+		// Use test email address if in test mode
+		if testMode {
+			member.Email = testEmail
+		}
+		err = emailHandler.SendSessionExpired(member, submission)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	for _, submission := range received {
+		if submission.SubmissionState == db.ReceivedSubmissionState {
+			remaining = append(remaining, submission)
+		}
+	}
+	return remaining, expired, nil
+}
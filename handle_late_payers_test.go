@@ -0,0 +1,40 @@
+package main
+
+import (
+	"benjitucker/bathrc-accounts/db"
+	"testing"
+	"time"
+)
+
+func TestFindLatePayers(t *testing.T) {
+	saved := sessionCapacities
+	defer func() { sessionCapacities = saved }()
+	sessionCapacities = map[string]int{"Widbrook": 2}
+
+	session := time.Date(2026, 5, 1, 19, 0, 0, 0, time.UTC)
+	otherSession := session.Add(time.Hour)
+
+	newSub := func(id string, date time.Time, paymentRecordId string) *db.TrainingSubmission {
+		sub := &db.TrainingSubmission{Venue: "Widbrook", TrainingDate: date, PaymentRecordId: paymentRecordId}
+		sub.SetID(id)
+		return sub
+	}
+
+	paid := []*db.TrainingSubmission{
+		newSub("1-0", session, "P1"),
+		newSub("2-0", session, "P2"),
+		newSub("3-0", otherSession, "P3"),
+	}
+	partPaid := newSub("6-0", session, "")
+	partPaid.Allocations = []db.PaymentAllocation{{TransactionId: "T1", AmountPence: 1000}}
+	received := []*db.TrainingSubmission{
+		newSub("4-0", session, ""),
+		newSub("5-0", otherSession, ""),
+		partPaid,
+	}
+
+	late := findLatePayers(received, paid)
+	if len(late) != 1 || late[0].GetID() != "4-0" {
+		t.Fatalf("expected only 4-0 to be late, not the part paid 6-0, got %v", late)
+	}
+}
@@ -4,19 +4,31 @@ import (
 	"benjitucker/bathrc-accounts/db"
 	"fmt"
 	"log"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 )
 
 // handleMembers processes new member records, updates the database, and sends necessary training confirmation emails.
 func handleMembers(records []*db.MemberRecord) error {
-	err := memberTable.PutAll(records)
+	stored, err := memberTable.GetAll()
 	if err != nil {
 		return err
 	}
 
-	emailHandler.SendEmail(testEmail, "jotform webhook: Training Admin",
-		fmt.Sprintf("Uploaded member table with %d members\n", len(records)))
+	diff := diffMembers(records, stored, time.Now())
+
+	err = memberTable.PutAll(records)
+	if err != nil {
+		return err
+	}
+
+	err = emailHandler.SendEmail(testEmail, "jotform webhook: Training Admin",
+		fmt.Sprintf("Uploaded member table with %d members\n\n%s", len(records), diff))
+	if err != nil {
+		return err
+	}
 
 	// Work out which member training confirmations email have not been sent and send them
 
@@ -61,11 +73,14 @@ func handleMembers(records []*db.MemberRecord) error {
 
 				// Send email to members of linked submissions warning that this
 				// membership number is invalid, if the linked submission are valid themselves
-				emailHandler.SendProblemMessage(linkedMemberRecords, submission, fmt.Sprintf(`
+				err = emailHandler.SendProblemMessage(linkedMemberRecords, submission, fmt.Sprintf(`
 The additional session cannot be processed because the membership number %s is not valid. This means
 that no sessions have been booked for you. Please submit a new training request for all sessions with the
 correct information.
 `, submission.MembershipNumber))
+				if err != nil {
+					return err
+				}
 
 				// Drop the submission set
 				for _, sub := range linkedSubmissions {
@@ -97,6 +112,12 @@ correct information.
 				return err
 			}
 
+			// check the amount against the price of the session, as when a request is made by a known member
+			err = checkAndReportSessionPrice(updatedMemberRecord, submission)
+			if err != nil {
+				return err
+			}
+
 			// At this point Membership has just been created, time to send the received request email
 			// That will be handled by the following code...
 		}
@@ -124,13 +145,10 @@ correct information.
 			sendEmailsAndUpdate := func(extraText string) error {
 				// but only if the linked set all have valid members
 				if len(linkedSubmissions) == len(linkedMemberRecords) {
-					emailHandler.SendReceivedRequest(linkedMemberRecords, linkedSubmissions, extraText)
-
-					// update linked submissions
-					for _, sub := range linkedSubmissions {
-						sub.ReceivedRequestEmailSent = true
-					}
-					err = trainTable.PutAll(linkedSubmissions)
+					// this also updates the linked submissions
+					err = sendReceivedRequest(linkedMemberRecords, linkedSubmissions, strings.TrimSpace(
+						extraText+" "+alreadyBookedText(linkedMemberRecords, linkedSubmissions)+" "+
+							priceMismatchText(linkedMemberRecords, linkedSubmissions)))
 					if err != nil {
 						return err
 					}
@@ -211,6 +229,33 @@ func findSubmissionSet(linkedIds []string, recvSubs []*db.TrainingSubmission) ([
 	return members, submissions, nil
 }
 
+// unlinkSubmission removes a submission from its linked set, so the rest of the set can be paid for without it,
+// and leaves the submission linked only to itself.
+func unlinkSubmission(submission *db.TrainingSubmission, recvSubs []*db.TrainingSubmission) error {
+	_, linkedSubmissions, err := findSubmissionSet(submission.LinkedSubmissionIds, recvSubs)
+	if err != nil {
+		return err
+	}
+
+	var others []*db.TrainingSubmission
+	for _, linked := range linkedSubmissions {
+		if linked.GetID() == submission.GetID() {
+			continue
+		}
+		linked.LinkedSubmissionIds = slices.DeleteFunc(linked.LinkedSubmissionIds, func(id string) bool {
+			return id == submission.GetID()
+		})
+		others = append(others, linked)
+	}
+	err = trainTable.PutAll(others)
+	if err != nil {
+		return err
+	}
+
+	submission.LinkedSubmissionIds = []string{submission.GetID()}
+	return nil
+}
+
 func findMemberInRecords(number string, records []*db.MemberRecord) *db.MemberRecord {
 	for _, record := range records {
 		if record.MemberNumber == number {
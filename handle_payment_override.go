@@ -0,0 +1,272 @@
+package main
+
+import (
+	"benjitucker/bathrc-accounts/db"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Manual payment allocation actions on the Training Administration form
+const (
+	attachAllocationAction = "attach"
+	detachAllocationAction = "detach"
+	refundAllocationAction = "refund"
+)
+
+// handlePaymentOverride lets the treasurer attach a transaction to a booking that it was not matched to, e.g. because
+// the member typed the wrong payment reference, or detach a transaction from a booking it was wrongly matched to.
+// allocateTo is a payment reference or submission ID, and may be empty when detaching from every booking. The
+// treasurer also records refunds of credit owed to a member this way, with the refund payment as the transaction and
+// the member number as allocateTo.
+func handlePaymentOverride(action, transactionId, allocateTo string) error {
+	transactionId = strings.TrimSpace(transactionId)
+	allocateTo = strings.TrimSpace(allocateTo)
+
+	transaction, err := transactionTable.Get(transactionId)
+	if err != nil {
+		return err
+	}
+	if transaction == nil {
+		return fmt.Errorf("no transaction found with id %s", transactionId)
+	}
+
+	if strings.ToLower(strings.TrimSpace(action)) == refundAllocationAction {
+		return refundCredit(transaction, allocateTo)
+	}
+
+	candidates, err := getAllocationCandidates()
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(strings.TrimSpace(action)) {
+	case attachAllocationAction:
+		return attachTransaction(transaction, allocateTo, candidates)
+	case detachAllocationAction:
+		return detachTransaction(transaction, allocateTo, candidates)
+	default:
+		return fmt.Errorf("unknown payment allocation action %q", action)
+	}
+}
+
+// getAllocationCandidates returns the submissions a transaction could be attached to or detached from.
+func getAllocationCandidates() ([]*db.TrainingSubmission, error) {
+	candidates, err := trainTable.GetAllOfState(db.ReceivedSubmissionState)
+	if err != nil {
+		return nil, err
+	}
+	for _, state := range []string{db.PaidSubmissionState, db.InPastSubmissionState} {
+		subs, err := trainTable.GetAllOfStateRecent(state, time.Now().Add(-latePaymentsDuration))
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, subs...)
+	}
+	return candidates, nil
+}
+
+// findAllocationTarget finds the submission identified by a submission ID or, failing that, a payment reference.
+func findAllocationTarget(allocateTo string, candidates []*db.TrainingSubmission) (*db.TrainingSubmission, error) {
+	for _, submission := range candidates {
+		if submission.GetID() == allocateTo {
+			return submission, nil
+		}
+	}
+
+	var found *db.TrainingSubmission
+	for _, submission := range candidates {
+		if !strings.EqualFold(submission.PaymentReference, allocateTo) {
+			continue
+		}
+		if found != nil && !slices.Contains(found.LinkedSubmissionIds, submission.GetID()) {
+			return nil, fmt.Errorf("payment reference %s is used by more than one booking, use a submission ID",
+				allocateTo)
+		}
+		if found == nil {
+			found = submission
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("no booking found for %s", allocateTo)
+	}
+	return found, nil
+}
+
+// attachTransaction allocates the unused part of a transaction to a booking and sends the members the received
+// payment or part payment email.
+func attachTransaction(transaction *db.TransactionRecord, allocateTo string,
+	candidates []*db.TrainingSubmission) error {
+
+	target, err := findAllocationTarget(allocateTo, candidates)
+	if err != nil {
+		return err
+	}
+
+	_, set, err := findSubmissionSet(target.LinkedSubmissionIds, candidates)
+	if err != nil {
+		return err
+	}
+	if setAmountDue(set) <= 0 || target.PaymentRecordId != "" {
+		return fmt.Errorf("booking %s (ref:%s) is already paid", target.GetID(), target.PaymentReference)
+	}
+
+	updateTransactionUsage([]*db.TransactionRecord{transaction}, candidates)
+	remaining := transaction.RemainingPence()
+	if remaining <= 0 {
+		return fmt.Errorf("transaction %s has already been used, detach it first", transaction.GetID())
+	}
+
+	fmt.Printf("attaching transaction %s to submission id %s (ref:%s)\n",
+		transaction.GetID(), target.GetID(), target.PaymentReference)
+
+	for _, submission := range set {
+		submission.RejectedTransactionIds = slices.DeleteFunc(submission.RejectedTransactionIds, func(id string) bool {
+			return id == transaction.GetID()
+		})
+	}
+
+	allocated := allocateToSet(transaction, set, remaining)
+	err = handlePaymentAllocation(transaction, set, remaining-allocated, set)
+	if err != nil {
+		return err
+	}
+	err = transactionTable.Put(transaction)
+	if err != nil {
+		return err
+	}
+
+	return emailHandler.SendEmail(testEmail, "Training: Payment attached",
+		fmt.Sprintf("Transaction %s attached to payment ref %s, %s allocated",
+			transaction.String(), target.PaymentReference, formatAmount(allocated)))
+}
+
+// removeAllocation removes a transaction's allocations from a set and marks the transaction as not belonging to it,
+// so it is not matched again. A set that the transaction had paid for is returned to unpaid. It reports whether the
+// set was changed.
+func removeAllocation(transactionId string, set []*db.TrainingSubmission) bool {
+	if !slices.ContainsFunc(set, func(submission *db.TrainingSubmission) bool {
+		return submission.PaidBy(transactionId)
+	}) {
+		return false
+	}
+
+	for _, submission := range set {
+		submission.Allocations = slices.DeleteFunc(submission.Allocations, func(allocation db.PaymentAllocation) bool {
+			return allocation.TransactionId == transactionId
+		})
+		if submission.PaymentRecordId == transactionId {
+			submission.PaymentRecordId = ""
+			submission.PaymentDiscrepancy = false
+			if submission.SubmissionState == db.PaidSubmissionState {
+				submission.SubmissionState = db.ReceivedSubmissionState
+			}
+		}
+		if !slices.Contains(submission.RejectedTransactionIds, transactionId) {
+			submission.RejectedTransactionIds = append(submission.RejectedTransactionIds, transactionId)
+		}
+	}
+	return true
+}
+
+// detachTransaction removes a transaction from the booking it was wrongly matched to, or from all bookings when
+// allocateTo is empty, and cancels any overpayment credit recorded for it.
+func detachTransaction(transaction *db.TransactionRecord, allocateTo string,
+	candidates []*db.TrainingSubmission) error {
+
+	var targets []*db.TrainingSubmission
+	if allocateTo != "" {
+		target, err := findAllocationTarget(allocateTo, candidates)
+		if err != nil {
+			return err
+		}
+		targets = append(targets, target)
+	} else {
+		for _, submission := range candidates {
+			if submission.PaidBy(transaction.GetID()) {
+				targets = append(targets, submission)
+			}
+		}
+	}
+
+	updateTransactionUsage([]*db.TransactionRecord{transaction}, candidates)
+
+	detached := make(map[string]bool)
+	var refs []string
+	for _, target := range targets {
+		if detached[target.GetID()] {
+			continue
+		}
+		_, set, err := findSubmissionSet(target.LinkedSubmissionIds, candidates)
+		if err != nil {
+			return err
+		}
+		var allocated int64
+		for _, submission := range set {
+			detached[submission.GetID()] = true
+			for _, allocation := range submission.Allocations {
+				if allocation.TransactionId == transaction.GetID() {
+					allocated += allocation.AmountPence
+				}
+			}
+		}
+		if !removeAllocation(transaction.GetID(), set) {
+			continue
+		}
+		transaction.UsedPence = max(transaction.UsedPence-allocated, 0)
+
+		fmt.Printf("detaching transaction %s from submission id %s (ref:%s)\n",
+			transaction.GetID(), target.GetID(), target.PaymentReference)
+
+		err = cancelDiscrepancyCredits(transaction, set)
+		if err != nil {
+			return err
+		}
+		err = trainTable.PutAll(set)
+		if err != nil {
+			return err
+		}
+		refs = append(refs, target.PaymentReference)
+	}
+
+	if len(refs) == 0 {
+		return fmt.Errorf("transaction %s is not attached to %s", transaction.GetID(), allocateTo)
+	}
+
+	// the transaction is still used up if it completed the payment of a booking it was not detached from
+	transaction.Consumed = slices.ContainsFunc(candidates, func(submission *db.TrainingSubmission) bool {
+		return submission.PaymentRecordId == transaction.GetID()
+	})
+	err := transactionTable.Put(transaction)
+	if err != nil {
+		return err
+	}
+
+	return emailHandler.SendEmail(testEmail, "Training: Payment detached",
+		fmt.Sprintf("Transaction %s detached from payment ref %s", transaction.String(), strings.Join(refs, ", ")))
+}
+
+// cancelDiscrepancyCredits zeroes any over or under payment recorded when the transaction was matched to the set.
+func cancelDiscrepancyCredits(transaction *db.TransactionRecord, set []*db.TrainingSubmission) error {
+	for _, submission := range set {
+		for _, kind := range []string{db.OverpaymentCreditKind, db.UnderpaymentCreditKind} {
+			id := db.MakeCreditId(kind, submission.MembershipNumber, transaction.GetID())
+			record, err := creditTable.Get(id)
+			if err != nil {
+				return err
+			}
+			if record == nil || record.AmountPence == 0 {
+				continue
+			}
+			record.Note = fmt.Sprintf("%s, cancelled as payment detached (was %s)", record.Note,
+				formatAmount(record.AmountPence))
+			record.AmountPence = 0
+			err = creditTable.Put(record, id)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
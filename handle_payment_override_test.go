@@ -0,0 +1,76 @@
+package main
+
+import (
+	"benjitucker/bathrc-accounts/db"
+	"testing"
+)
+
+func TestFindAllocationTarget(t *testing.T) {
+	sub1 := newAllocationTestSubmission("1-0", "ABCD", 2500, "1-0", "1-1")
+	sub2 := newAllocationTestSubmission("1-1", "ABCD", 2500, "1-0", "1-1")
+	sub3 := newAllocationTestSubmission("2-0", "WXYZ", 2500, "2-0")
+	sub4 := newAllocationTestSubmission("3-0", "WXYZ", 2500, "3-0")
+	candidates := []*db.TrainingSubmission{sub1, sub2, sub3, sub4}
+
+	got, err := findAllocationTarget("1-1", candidates)
+	if err != nil || got != sub2 {
+		t.Errorf("expected submission 1-1 by ID, got %v, %v", got, err)
+	}
+
+	got, err = findAllocationTarget("abcd", candidates)
+	if err != nil || got != sub1 {
+		t.Errorf("expected submission 1-0 by reference, got %v, %v", got, err)
+	}
+
+	if _, err = findAllocationTarget("WXYZ", candidates); err == nil {
+		t.Errorf("expected an error for a reference used by two bookings")
+	}
+
+	if _, err = findAllocationTarget("NONE", candidates); err == nil {
+		t.Errorf("expected an error when nothing matches")
+	}
+}
+
+func TestRemoveAllocation(t *testing.T) {
+	sub1 := newAllocationTestSubmission("1-0", "ABCD", 2500, "1-0", "1-1")
+	sub2 := newAllocationTestSubmission("1-1", "ABCD", 2500, "1-0", "1-1")
+	set := []*db.TrainingSubmission{sub1, sub2}
+
+	first := newAllocationTestTransaction("T1", "ABCD", 3000, 2)
+	second := newAllocationTestTransaction("T2", "ABCD", 2000, 3)
+	allocateToSet(first, set, first.AmountPence)
+	allocateToSet(second, set, second.AmountPence)
+	sub1.PaymentDiscrepancy = true
+
+	if sub1.SubmissionState != db.PaidSubmissionState {
+		t.Fatalf("expected set to be paid before detaching")
+	}
+
+	if removeAllocation("T9", set) {
+		t.Errorf("expected no change for a transaction not attached to the set")
+	}
+
+	if !removeAllocation("T2", set) {
+		t.Fatalf("expected set to change")
+	}
+	for _, sub := range set {
+		if sub.SubmissionState != db.ReceivedSubmissionState || sub.PaymentRecordId != "" || sub.PaymentDiscrepancy {
+			t.Errorf("expected %s to be unpaid again, got %+v", sub.GetID(), sub)
+		}
+		if sub.PaidBy("T2") {
+			t.Errorf("expected T2 allocation removed from %s", sub.GetID())
+		}
+	}
+	if !sub1.PaidBy("T1") || !sub2.PaidBy("T1") {
+		t.Errorf("expected the first instalment to stay allocated")
+	}
+	if setAmountDue(set) != 2000 {
+		t.Errorf("expected £20 outstanding, got %d", setAmountDue(set))
+	}
+
+	// The detached transaction is not matched to the set again
+	matches, _ := allocatePayments([]*db.TransactionRecord{second}, set, nil, nil)
+	if len(matches) != 0 {
+		t.Errorf("expected detached transaction not to be matched again, got %+v", matches)
+	}
+}
@@ -13,6 +13,13 @@ import (
 func handleHourly(testMode bool) error {
 
 	now := time.Now()
+
+	// Retry the emails that failed to send
+	err := handleOutbox(now)
+	if err != nil {
+		return fmt.Errorf("failed to drain email outbox: %w", err)
+	}
+
 	// Get all training submissions here as they are used an a few places
 	receivedSubmissions, err := trainTable.GetAllOfStateRecent(db.ReceivedSubmissionState, now)
 	if err != nil {
@@ -32,11 +39,39 @@ func handleHourly(testMode bool) error {
 		return fmt.Errorf("failed to update in-past submissions: %w", err)
 	}
 
+	waitingSubmissions, err := trainTable.GetAllOfStateRecent(db.WaitingSubmissionState, now)
+	if err != nil {
+		return err
+	}
+	waitingSubmissions, err = updateInPastSubmissions(waitingSubmissions)
+	if err != nil {
+		return fmt.Errorf("failed to update in-past submissions: %w", err)
+	}
+
+	expiredSubmissions, err := trainTable.GetAllOfStateRecent(db.ExpiredSubmissionState, now)
+	if err != nil {
+		return err
+	}
+
+	// Fill any free places from the waiting lists
+	receivedSubmissions, err = handleWaitingList(receivedSubmissions, paidSubmissions, waitingSubmissions)
+	if err != nil {
+		return fmt.Errorf("failed to handle waiting lists: %w", err)
+	}
+
+	// Release unpaid places in sessions that have been filled by paid submissions
+	receivedSubmissions, newlyExpired, err := handleLatePayers(receivedSubmissions, paidSubmissions)
+	if err != nil {
+		return fmt.Errorf("failed to handle late payers: %w", err)
+	}
+	expiredSubmissions = append(expiredSubmissions, newlyExpired...)
+
 	submissions := append(receivedSubmissions, paidSubmissions...)
 	log.Printf("Got %d received and %d paid submissions for future sessions",
 		len(receivedSubmissions), len(paidSubmissions))
 
-	err = handleSubmissionsCheck(submissions)
+	// Include the waiting and expired submissions so they are not mistaken for missing ones
+	err = handleSubmissionsCheck(append(append(submissions, waitingSubmissions...), expiredSubmissions...))
 	if err != nil {
 		return err
 	}
@@ -56,12 +91,21 @@ func handleHourly(testMode bool) error {
 
 	// Email a summary of training submissions to the club email lunchtime and 8pm two days before
 	if now.Hour() == 12 || now.Hour() == 20 || testMode == true {
-		err := handleTrainingSummary(submissions, until)
+		// Expired submissions are included so the released places are shown
+		err := handleTrainingSummary(append(submissions, expiredSubmissions...), until)
 		if err != nil {
 			return err
 		}
 	}
 
+	// Remind members to renew their membership once a day at 9AM
+	if now.Hour() == 9 || testMode == true {
+		err := handleRenewalReminders(submissions, now)
+		if err != nil {
+			return fmt.Errorf("failed to handle renewal reminders: %w", err)
+		}
+	}
+
 	// Email a summary of transactions to me on the 5th of the month at 10AM
 	if (now.Day() == 5 && now.Hour() == 10) || testMode == true {
 		err := handleTransactionsSummary()
@@ -72,6 +116,25 @@ func handleHourly(testMode bool) error {
 	return nil
 }
 
+// handleOutbox retries the queued emails that are due and tells the admin about any that have been given up on.
+func handleOutbox(now time.Time) error {
+	failed, err := emailHandler.DrainOutbox(now)
+	if err != nil {
+		return err
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+
+	var lines []string
+	for _, message := range failed {
+		lines = append(lines, message.String())
+	}
+	return emailHandler.SendEmail(testEmail, "Emails FAILED",
+		fmt.Sprintf("%d emails could not be sent and will not be retried\n\n%s", len(failed),
+			strings.Join(lines, "\n")))
+}
+
 // handlePayReminder identifies submissions that haven't been paid for and sends reminder emails to the respective members.
 func handlePayReminder(receivedSubmissions []*db.TrainingSubmission) error {
 	for _, submission := range receivedSubmissions {
@@ -117,9 +180,12 @@ func handlePayReminder(receivedSubmissions []*db.TrainingSubmission) error {
 		if len(linkedSubmissions) == len(linkedMemberRecords) {
 			fmt.Printf("sending a reminder for payment of submission id %s and linked\n", earliestSubmission.GetID())
 
-			emailHandler.SendPayReminder(linkedMemberRecords, linkedSubmissions)
+			err = emailHandler.SendPayReminder(linkedMemberRecords, linkedSubmissions)
+			if err != nil {
+				return err
+			}
 
-			// update linked submissions
+			// update linked submissions, now the reminder has been sent
 			for _, sub := range linkedSubmissions {
 				sub.PayReminderEmailSent = true
 			}
@@ -170,12 +236,12 @@ func dayWithSuffix(day int) string {
 
 func handleTrainingSummary(submissions []*db.TrainingSubmission, until time.Time) error {
 	return writeEmails(until, submissions, memberTable.Get,
-		func(subject, body string) {
+		func(subject, body string) error {
 			email := clubEmail
 			if testMode == true {
 				email = testEmail
 			}
-			emailHandler.SendEmail(email, subject, body)
+			return emailHandler.SendEmail(email, subject, body)
 		})
 }
 
@@ -187,7 +253,7 @@ func dateOnly(timeDate time.Time) time.Time {
 // writeEmails generates and sends summary emails for upcoming training sessions, grouped by venue and time.
 func writeEmails(until time.Time, submissions []*db.TrainingSubmission,
 	getMember func(id string) (*db.MemberRecord, error),
-	emailer func(subject, body string)) error {
+	emailer func(subject, body string) error) error {
 	var err error
 	today := dateOnly(time.Now())
 	yesterday := today.AddDate(0, 0, -1)
@@ -228,13 +294,16 @@ func writeEmails(until time.Time, submissions []*db.TrainingSubmission,
 		for _, tTime := range tTimes {
 			submissions := daySubs[tTime]
 
-			// Sort submissions: Paid first, then Incorrect Payment, then NOT PAID
+			// Sort submissions: Paid first, then Incorrect Payment, then NOT PAID, then Released
 			// Within each group, sort by request date
 			sort.SliceStable(submissions, func(i, j int) bool {
 				sI := submissions[i]
 				sJ := submissions[j]
 
 				rank := func(s *db.TrainingSubmission) int {
+					if s.SubmissionState == db.ExpiredSubmissionState {
+						return 4 // Released
+					}
 					if s.PaymentRecordId != "" {
 						if !s.PaymentDiscrepancy {
 							return 1 // Paid
@@ -282,21 +351,30 @@ func writeEmails(until time.Time, submissions []*db.TrainingSubmission,
 					summary.messageLines = append(summary.messageLines, timeHeader, "")
 				}
 
+				released := submission.SubmissionState == db.ExpiredSubmissionState
 				member := summary.members[submission.MembershipNumber]
 				if member == nil {
 					member, err = getMember(submission.MembershipNumber)
 					if err != nil {
 						return err
 					}
-					summaries[submission.Venue].members[submission.MembershipNumber] = member
+					// Members whose place was released are not riding so leave them off the email list
+					if !released {
+						summaries[submission.Venue].members[submission.MembershipNumber] = member
+					}
 				}
 
 				notPaidString := ""
-				if submission.PaymentRecordId == "" {
+				if released {
+					notPaidString = " *Released - not paid*"
+				} else if submission.PaymentRecordId == "" {
 					notPaidString = " *NOT PAID*"
 				} else if submission.PaymentDiscrepancy == true {
 					notPaidString = " *Incorrect Payment*"
 				}
+				if submission.AlreadyBooked {
+					notPaidString += " *Double Booked*"
+				}
 				requestedLabel := ""
 				requestDay := dateOnly(submission.RequestDate)
 				if requestDay.Equal(today) {
@@ -325,7 +403,7 @@ func writeEmails(until time.Time, submissions []*db.TrainingSubmission,
 			}
 			futureByMember := make(map[string]*futureEntry)
 			for _, submission := range submissions {
-				if submission.Venue != venue {
+				if submission.Venue != venue || submission.SubmissionState == db.ExpiredSubmissionState {
 					continue
 				}
 				if dateOnly(submission.TrainingDate).After(tDate) == false {
@@ -362,7 +440,10 @@ func writeEmails(until time.Time, submissions []*db.TrainingSubmission,
 				_, _ = fmt.Fprintf(&builder, "%s; ", member.Email)
 			}
 
-			emailer(fmt.Sprintf("%s Training Request Summary", venue), builder.String())
+			err = emailer(fmt.Sprintf("%s Training Request Summary", venue), builder.String())
+			if err != nil {
+				return err
+			}
 		}
 	}
 	return nil
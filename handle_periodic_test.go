@@ -75,11 +75,12 @@ func TestWriteEmails_MultipleDatesAndTimes(t *testing.T) {
 		body    string
 	}
 
-	mockEmailer := func(subject, body string) {
+	mockEmailer := func(subject, body string) error {
 		emails = append(emails, struct {
 			subject string
 			body    string
 		}{subject, body})
+		return nil
 	}
 
 	err := writeEmails(now.Add(time.Hour*36), submissions, getMember, mockEmailer)
@@ -200,11 +201,12 @@ func TestWriteEmails_FutureSubmissionsSection(t *testing.T) {
 		body    string
 	}
 
-	mockEmailer := func(subject, body string) {
+	mockEmailer := func(subject, body string) error {
 		emails = append(emails, struct {
 			subject string
 			body    string
 		}{subject, body})
+		return nil
 	}
 
 	err := writeEmails(now.Add(time.Hour*36), submissions, getMember, mockEmailer)
@@ -270,8 +272,9 @@ func TestWriteEmails_RequestedLabels(t *testing.T) {
 	}
 
 	var body string
-	mockEmailer := func(subject, emailBody string) {
+	mockEmailer := func(subject, emailBody string) error {
 		body = emailBody
+		return nil
 	}
 
 	err := writeEmails(now.Add(36*time.Hour), submissions, getMember, mockEmailer)
@@ -322,11 +325,12 @@ func TestWriteEmails_HourlyLists(t *testing.T) {
 		body    string
 	}
 
-	mockEmailer := func(subject, body string) {
+	mockEmailer := func(subject, body string) error {
 		emails = append(emails, struct {
 			subject string
 			body    string
 		}{subject, body})
+		return nil
 	}
 
 	err := writeEmails(now.Add(time.Hour*48), submissions, getMember, mockEmailer)
@@ -359,3 +363,99 @@ func TestWriteEmails_HourlyLists(t *testing.T) {
 		t.Errorf("Email missing evening time: %s", eveningStr)
 	}
 }
+
+func TestWriteEmails_ReleasedSubmissions(t *testing.T) {
+	now := time.Now()
+	trainingDate := now.Add(2 * time.Hour)
+
+	submissions := []*db.TrainingSubmission{
+		{
+			SubmissionState:   db.ExpiredSubmissionState,
+			TrainingDate:      trainingDate,
+			Venue:             "Arena1",
+			MembershipNumber:  "M030",
+			HorseName:         "LateHorse",
+			FoundMemberRecord: true,
+			RequestDate:       now.AddDate(0, 0, -3),
+		},
+		{
+			SubmissionState:   db.PaidSubmissionState,
+			TrainingDate:      trainingDate,
+			Venue:             "Arena1",
+			MembershipNumber:  "M031",
+			HorseName:         "PaidHorse",
+			FoundMemberRecord: true,
+			PaymentRecordId:   "P031",
+			RequestDate:       now.AddDate(0, 0, -2),
+		},
+	}
+
+	var body string
+	mockEmailer := func(subject, emailBody string) error {
+		body = emailBody
+		return nil
+	}
+
+	err := writeEmails(now.Add(36*time.Hour), submissions, getMember, mockEmailer)
+	if err != nil {
+		t.Fatalf("writeEmails returned error: %v", err)
+	}
+
+	if !strings.Contains(body, "LateHorse *Released - not paid*") {
+		t.Fatalf("missing Released label: %s", body)
+	}
+
+	if strings.Index(body, "PaidHorse") > strings.Index(body, "LateHorse") {
+		t.Errorf("released submission should be listed after paid ones: %s", body)
+	}
+
+	if strings.Contains(body, "M030@example.com") {
+		t.Errorf("released member should not be in the email addresses: %s", body)
+	}
+}
+
+func TestWriteEmails_DoubleBooked(t *testing.T) {
+	now := time.Now()
+	trainingDate := now.Add(2 * time.Hour)
+
+	submissions := []*db.TrainingSubmission{
+		{
+			TrainingDate:      trainingDate,
+			Venue:             "Arena1",
+			MembershipNumber:  "M040",
+			HorseName:         "FirstHorse",
+			FoundMemberRecord: true,
+			PaymentRecordId:   "P040",
+			RequestDate:       now.AddDate(0, 0, -3),
+		},
+		{
+			TrainingDate:              trainingDate,
+			Venue:                     "Arena1",
+			MembershipNumber:          "M040",
+			HorseName:                 "SecondHorse",
+			FoundMemberRecord:         true,
+			PaymentRecordId:           "P041",
+			RequestDate:               now.AddDate(0, 0, -3),
+			AlreadyBooked:             true,
+			AlreadyBookedSubmissionId: "1-0",
+		},
+	}
+
+	var body string
+	mockEmailer := func(subject, emailBody string) error {
+		body = emailBody
+		return nil
+	}
+
+	err := writeEmails(now.Add(36*time.Hour), submissions, getMember, mockEmailer)
+	if err != nil {
+		t.Fatalf("writeEmails returned error: %v", err)
+	}
+
+	if !strings.Contains(body, "SecondHorse *Double Booked*") {
+		t.Fatalf("missing Double Booked label: %s", body)
+	}
+	if strings.Contains(body, "FirstHorse *Double Booked*") {
+		t.Errorf("unexpected Double Booked label on first booking: %s", body)
+	}
+}
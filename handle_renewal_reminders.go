@@ -0,0 +1,125 @@
+package main
+
+import (
+	"benjitucker/bathrc-accounts/db"
+	"log"
+	"sort"
+	"time"
+)
+
+// renewalReminderWindow is how long before a membership expires that the member is reminded to renew it.
+var renewalReminderWindow = time.Hour * 24 * 30
+
+// expiryWarning is a member with training sessions booked at the member rate for dates their membership does not cover.
+type expiryWarning struct {
+	member      *db.MemberRecord
+	submissions []*db.TrainingSubmission
+}
+
+// findRenewalReminders finds the current members whose membership expires within the window and who have not already
+// been reminded about that expiry date.
+func findRenewalReminders(members []*db.MemberRecord, now time.Time, window time.Duration) []*db.MemberRecord {
+	var result []*db.MemberRecord
+	for _, member := range members {
+		if member.Email == "" || !membershipDateCheck(member, &now) {
+			continue
+		}
+		if member.MembershipValidTo.After(now.Add(window)) {
+			continue
+		}
+		if member.RenewalReminderSent != nil && member.RenewalReminderSent.Equal(*member.MembershipValidTo) {
+			continue
+		}
+		result = append(result, member)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].MemberNumber < result[j].MemberNumber
+	})
+	return result
+}
+
+// findExpiryWarnings finds the submissions booked at the member rate for sessions after the member's membership
+// expires, grouped by member. The member record is checked again as the membership may have been renewed since the
+// request was made.
+func findExpiryWarnings(submissions []*db.TrainingSubmission,
+	getMember func(membershipNumber string) (*db.MemberRecord, error)) ([]*expiryWarning, error) {
+
+	byMember := make(map[string]*expiryWarning)
+	var result []*expiryWarning
+	for _, submission := range submissions {
+		if !submission.RequestCurrMem || submission.ExpiryWarningEmailSent {
+			continue
+		}
+		member, err := getMember(submission.MembershipNumber)
+		if err != nil {
+			return nil, err
+		}
+		if member == nil || member.MembershipValidTo == nil || member.Email == "" {
+			continue
+		}
+		if membershipDateCheck(member, &submission.TrainingDate) {
+			continue
+		}
+
+		warning := byMember[member.MemberNumber]
+		if warning == nil {
+			warning = &expiryWarning{member: member}
+			byMember[member.MemberNumber] = warning
+			result = append(result, warning)
+		}
+		warning.submissions = append(warning.submissions, submission)
+	}
+
+	for _, warning := range result {
+		sort.Slice(warning.submissions, func(i, j int) bool {
+			return warning.submissions[i].TrainingDate.Before(warning.submissions[j].TrainingDate)
+		})
+	}
+	return result, nil
+}
+
+// handleRenewalReminders emails members whose membership is about to expire, and warns members who have booked
+// training at the member rate for sessions after their membership expires.
+func handleRenewalReminders(submissions []*db.TrainingSubmission, now time.Time) error {
+	members, err := memberTable.GetAll()
+	if err != nil {
+		return err
+	}
+
+	for _, member := range findRenewalReminders(members, now, renewalReminderWindow) {
+		log.Printf("Sending renewal reminder to %s %s (%s), membership expires %s",
+			member.FirstName, member.LastName, member.MemberNumber, member.MembershipValidTo.Format(dateLayout))
+		err = emailHandler.SendRenewalReminder(member)
+		if err != nil {
+			return err
+		}
+
+		member.RenewalReminderSent = member.MembershipValidTo
+		err = memberTable.Put(member)
+		if err != nil {
+			return err
+		}
+	}
+
+	warnings, err := findExpiryWarnings(submissions, memberTable.Get)
+	if err != nil {
+		return err
+	}
+	for _, warning := range warnings {
+		log.Printf("Warning %s %s (%s) that their membership expires before %d booked sessions",
+			warning.member.FirstName, warning.member.LastName, warning.member.MemberNumber, len(warning.submissions))
+		err = emailHandler.SendMembershipExpiryWarning(warning.member, warning.submissions)
+		if err != nil {
+			return err
+		}
+
+		for _, submission := range warning.submissions {
+			submission.ExpiryWarningEmailSent = true
+		}
+		err = trainTable.PutAll(warning.submissions)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"benjitucker/bathrc-accounts/db"
+	"testing"
+	"time"
+)
+
+func renewalTestMember(number, from, to string) *db.MemberRecord {
+	parse := func(s string) *time.Time {
+		d, _ := time.Parse(dateLayout, s)
+		return &d
+	}
+	return &db.MemberRecord{
+		MemberNumber:        number,
+		FirstName:           "First" + number,
+		Email:               number + "@example.com",
+		MembershipValidFrom: parse(from),
+		MembershipValidTo:   parse(to),
+	}
+}
+
+func TestFindRenewalReminders(t *testing.T) {
+	now := time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC)
+
+	alreadyReminded := renewalTestMember("M3", "2025-04-01", "2026-03-31")
+	alreadyReminded.RenewalReminderSent = alreadyReminded.MembershipValidTo
+
+	// Reminded about an earlier expiry, which has since been extended
+	remindedBefore := renewalTestMember("M4", "2025-04-01", "2026-04-05")
+	earlier := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	remindedBefore.RenewalReminderSent = &earlier
+
+	noEmail := renewalTestMember("M6", "2025-04-01", "2026-03-31")
+	noEmail.Email = ""
+
+	members := []*db.MemberRecord{
+		renewalTestMember("M2", "2025-04-01", "2026-03-31"),
+		renewalTestMember("M1", "2025-04-01", "2027-03-31"), // not due yet
+		alreadyReminded,
+		remindedBefore,
+		renewalTestMember("M5", "2025-03-01", "2026-03-01"), // already lapsed
+		noEmail,
+	}
+
+	got := findRenewalReminders(members, now, time.Hour*24*30)
+	if len(got) != 2 || got[0].MemberNumber != "M2" || got[1].MemberNumber != "M4" {
+		t.Fatalf("unexpected reminders %v", got)
+	}
+}
+
+func TestFindExpiryWarnings(t *testing.T) {
+	members := map[string]*db.MemberRecord{
+		"M1": renewalTestMember("M1", "2025-04-01", "2026-03-31"),
+		"M2": renewalTestMember("M2", "2026-04-01", "2027-03-31"),
+	}
+	getMember := func(number string) (*db.MemberRecord, error) {
+		return members[number], nil
+	}
+	submission := func(number string, day int, member bool) *db.TrainingSubmission {
+		return &db.TrainingSubmission{
+			MembershipNumber: number,
+			TrainingDate:     time.Date(2026, 3, 20, 19, 0, 0, 0, time.UTC).AddDate(0, 0, day),
+			RequestCurrMem:   member,
+		}
+	}
+
+	later := submission("M1", 21, true)
+	earlier := submission("M1", 14, true)
+	warned := submission("M1", 28, true)
+	warned.ExpiryWarningEmailSent = true
+
+	submissions := []*db.TrainingSubmission{
+		later,
+		submission("M1", 0, true),   // before the expiry
+		submission("M1", 14, false), // booked at the non-member rate
+		earlier,
+		warned,
+		submission("M2", 14, true), // renewed
+		submission("M9", 14, true), // unknown member
+	}
+
+	warnings, err := findExpiryWarnings(submissions, getMember)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 1 || warnings[0].member.MemberNumber != "M1" {
+		t.Fatalf("unexpected warnings %v", warnings)
+	}
+	if got := warnings[0].submissions; len(got) != 2 || got[0] != earlier || got[1] != later {
+		t.Errorf("unexpected submissions %v", got)
+	}
+}
@@ -19,7 +19,10 @@ func handleSendTrainingAppIntroEmails(records []*db.MemberRecord) error {
 		// This means their MembershipValidTo must be after twelveMonthsAgo.
 		if member.MembershipValidTo.After(twelveMonthsAgo) {
 			log.Printf("Sending app intro email to %s (%s)", member.FirstName+" "+member.LastName, member.Email)
-			emailHandler.SendAppIntro(member)
+			err := emailHandler.SendAppIntro(member)
+			if err != nil {
+				return err
+			}
 		}
 	}
 
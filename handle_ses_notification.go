@@ -0,0 +1,142 @@
+package main
+
+import (
+	"benjitucker/bathrc-accounts/db"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// SESNotification is the SES bounce or complaint notification published to the SNS topic
+type SESNotification struct {
+	NotificationType string        `json:"notificationType"` // "Bounce", "Complaint" or "Delivery"
+	Bounce           *SESBounce    `json:"bounce"`
+	Complaint        *SESComplaint `json:"complaint"`
+	Mail             struct {
+		MessageId string `json:"messageId"`
+	} `json:"mail"`
+}
+
+type SESBounce struct {
+	BounceType        string         `json:"bounceType"` // "Permanent", "Transient" or "Undetermined"
+	BounceSubType     string         `json:"bounceSubType"`
+	BouncedRecipients []SESRecipient `json:"bouncedRecipients"`
+}
+
+type SESComplaint struct {
+	ComplaintFeedbackType string         `json:"complaintFeedbackType"`
+	ComplainedRecipients  []SESRecipient `json:"complainedRecipients"`
+}
+
+type SESRecipient struct {
+	EmailAddress   string `json:"emailAddress"`
+	DiagnosticCode string `json:"diagnosticCode"`
+}
+
+// handleSNSEvent processes SES bounce and complaint notifications delivered by SNS.
+func handleSNSEvent(event events.SNSEvent) (any, error) {
+	fmt.Printf("Handle SNS event, %d records\n", len(event.Records))
+
+	for _, record := range event.Records {
+		var notification SESNotification
+		err := json.Unmarshal([]byte(record.SNS.Message), &notification)
+		if err == nil {
+			err = handleSESNotification(&notification)
+		}
+		if err != nil {
+			fmt.Printf("ERROR: %v\n", err)
+			if sendErr := emailHandler.SendEmail(testEmail, "SES notification: FAIL",
+				err.Error()+"\n\n"+record.SNS.Message); sendErr != nil {
+				fmt.Printf("ERROR: %v\n", sendErr)
+			}
+			return nil, err
+		}
+	}
+
+	return map[string]string{
+		"message": "ok",
+	}, nil
+}
+
+// undeliverableRecipients returns the email addresses that should no longer be sent to, with the reason why. Only
+// permanent bounces and complaints make an address undeliverable, transient bounces are expected to clear.
+func undeliverableRecipients(notification *SESNotification) ([]SESRecipient, string) {
+	switch {
+	case notification.NotificationType == "Bounce" && notification.Bounce != nil &&
+		notification.Bounce.BounceType == "Permanent":
+		return notification.Bounce.BouncedRecipients,
+			strings.TrimSpace("bounced " + notification.Bounce.BounceSubType)
+	case notification.NotificationType == "Complaint" && notification.Complaint != nil:
+		return notification.Complaint.ComplainedRecipients,
+			strings.TrimSpace("complained " + notification.Complaint.ComplaintFeedbackType)
+	default:
+		return nil, ""
+	}
+}
+
+// membersWithEmail returns the members using an email address, more than one when family members share an address.
+func membersWithEmail(members []*db.MemberRecord, address string) []*db.MemberRecord {
+	var result []*db.MemberRecord
+	for _, member := range members {
+		if strings.EqualFold(strings.TrimSpace(member.Email), strings.TrimSpace(address)) {
+			result = append(result, member)
+		}
+	}
+	return result
+}
+
+// handleSESNotification marks the members whose email address has bounced or complained as undeliverable, so no
+// more emails are sent to them, and asks the club to phone them.
+func handleSESNotification(notification *SESNotification) error {
+	recipients, reason := undeliverableRecipients(notification)
+	if len(recipients) == 0 {
+		fmt.Printf("Ignoring SES %s notification for message %s\n", notification.NotificationType,
+			notification.Mail.MessageId)
+		return nil
+	}
+
+	members, err := memberTable.GetAll()
+	if err != nil {
+		return err
+	}
+
+	for _, recipient := range recipients {
+		found := membersWithEmail(members, recipient.EmailAddress)
+		if len(found) == 0 {
+			err = emailHandler.SendEmail(testEmail, "Email undeliverable: "+recipient.EmailAddress,
+				fmt.Sprintf("Emails to %s, who is not a member, %s. %s", recipient.EmailAddress, reason,
+					recipient.DiagnosticCode))
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		for _, member := range found {
+			if !member.EmailDeliverable() {
+				// already known
+				continue
+			}
+			member.UndeliverableEmail = member.Email
+			member.UndeliverableReason = strings.TrimSpace(reason + " " + recipient.DiagnosticCode)
+			err = memberTable.Put(member)
+			if err != nil {
+				return err
+			}
+
+			err = emailHandler.SendEmail(clubEmail,
+				fmt.Sprintf("Email undeliverable: %s %s", member.FirstName, member.LastName),
+				fmt.Sprintf(`Emails to %s %s (membership number %s) at %s cannot be delivered, the email %s.
+
+No more emails will be sent to them until their email address is changed in Sport80. Please phone them to let them
+know, as they will not receive booking, payment or renewal emails.
+`, member.FirstName, member.LastName, member.MemberNumber, member.Email, member.UndeliverableReason))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"benjitucker/bathrc-accounts/db"
+	"encoding/json"
+	"testing"
+)
+
+func TestUndeliverableRecipients(t *testing.T) {
+	tests := []struct {
+		name       string
+		message    string
+		wantEmails []string
+		wantReason string
+	}{
+		{
+			name: "permanent bounce",
+			message: `{"notificationType":"Bounce","bounce":{"bounceType":"Permanent","bounceSubType":"General",
+				"bouncedRecipients":[{"emailAddress":"jane@example.com","diagnosticCode":"smtp; 550 5.1.1 user unknown"}]},
+				"mail":{"messageId":"msg-1"}}`,
+			wantEmails: []string{"jane@example.com"},
+			wantReason: "bounced General",
+		},
+		{
+			name: "transient bounce",
+			message: `{"notificationType":"Bounce","bounce":{"bounceType":"Transient","bounceSubType":"MailboxFull",
+				"bouncedRecipients":[{"emailAddress":"jane@example.com"}]}}`,
+		},
+		{
+			name: "complaint",
+			message: `{"notificationType":"Complaint","complaint":{"complaintFeedbackType":"abuse",
+				"complainedRecipients":[{"emailAddress":"john@example.com"}]}}`,
+			wantEmails: []string{"john@example.com"},
+			wantReason: "complained abuse",
+		},
+		{
+			name:    "delivery",
+			message: `{"notificationType":"Delivery","mail":{"messageId":"msg-2"}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var notification SESNotification
+			if err := json.Unmarshal([]byte(tt.message), &notification); err != nil {
+				t.Fatal(err)
+			}
+
+			recipients, reason := undeliverableRecipients(&notification)
+			if len(recipients) != len(tt.wantEmails) {
+				t.Fatalf("expected %d recipients, got %v", len(tt.wantEmails), recipients)
+			}
+			for i, recipient := range recipients {
+				if recipient.EmailAddress != tt.wantEmails[i] {
+					t.Errorf("expected %s, got %s", tt.wantEmails[i], recipient.EmailAddress)
+				}
+			}
+			if reason != tt.wantReason {
+				t.Errorf("expected reason %q, got %q", tt.wantReason, reason)
+			}
+		})
+	}
+}
+
+func TestMembersWithEmail(t *testing.T) {
+	members := []*db.MemberRecord{
+		{MemberNumber: "M1", Email: "Family@Example.com"},
+		{MemberNumber: "M2", Email: "family@example.com "},
+		{MemberNumber: "M3", Email: "other@example.com"},
+	}
+
+	found := membersWithEmail(members, "family@example.com")
+	if len(found) != 2 || found[0].MemberNumber != "M1" || found[1].MemberNumber != "M2" {
+		t.Errorf("expected both family members, got %v", found)
+	}
+}
+
+func TestEmailDeliverable(t *testing.T) {
+	member := &db.MemberRecord{Email: "jane@example.com"}
+	if !member.EmailDeliverable() {
+		t.Errorf("expected a new member to be deliverable")
+	}
+
+	member.UndeliverableEmail = "Jane@example.com"
+	if member.EmailDeliverable() {
+		t.Errorf("expected a bounced address to be undeliverable")
+	}
+
+	member.Email = "jane@new.example.com"
+	if !member.EmailDeliverable() {
+		t.Errorf("expected a changed address to be deliverable again")
+	}
+}
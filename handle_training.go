@@ -64,24 +64,35 @@ func handleTrainingRequest(submissionId string, request jotform_webhook.Training
 			ExpireAt:         requestDate.Add(trainingSubmissionRecordTTL).Unix(),
 			PaymentReference: rawRequest.PaymentReference,
 			// Assume everything will be ok to start with
-			FoundMemberRecord:        true,
-			LapsedMembership:         false,
-			AlreadyBooked:            false,
-			ReceivedRequestEmailSent: true,
+			FoundMemberRecord: true,
+			LapsedMembership:  false,
+			AlreadyBooked:     false,
+			// Set once the received request email has been sent
+			ReceivedRequestEmailSent: false,
 		})
 	}
 
-	memberRecords := make([]*db.MemberRecord, 2)
-	sendReceivedRequestEmail := true
+	accepted, waiting, err := checkSessionCapacity(submissionId, submissions)
+	if err != nil {
+		return err
+	}
 
-	for entryIndex, submission := range submissions {
-		// fill the cross-references
-		for i := range submissions {
+	err = handleWaitingSubmissions(waiting)
+	if err != nil {
+		return err
+	}
+
+	memberRecords := make([]*db.MemberRecord, len(accepted))
+	sendReceivedRequestEmail := len(accepted) > 0
+
+	for entryIndex, submission := range accepted {
+		// fill the cross-references, entries on a waiting list are not part of the set
+		for _, linked := range accepted {
 			submission.LinkedSubmissionIds =
-				append(submission.LinkedSubmissionIds, makeId(submissionId, i))
+				append(submission.LinkedSubmissionIds, linked.GetID())
 		}
 
-		err := trainTable.Put(submission, makeId(submissionId, entryIndex))
+		err := trainTable.Put(submission, submission.GetID())
 		if err != nil {
 			return err
 		}
@@ -92,16 +103,19 @@ func handleTrainingRequest(submissionId string, request jotform_webhook.Training
 			// if not all members are found, dont send an email at this time at all
 			sendReceivedRequestEmail = false
 
-			// email me on invalid membership number incase it's a new member
-			emailHandler.SendEmail(testEmail, "Training: REFRESH MEMBERSHIP",
-				fmt.Sprintf("no membership record (%s)", submission.MembershipNumber))
-
 			submission.FoundMemberRecord = false
 			// update
 			err = trainTable.Put(submission, submission.GetID())
 			if err != nil {
 				return err
 			}
+
+			// email me on invalid membership number incase it's a new member
+			err = emailHandler.SendEmail(testEmail, "Training: REFRESH MEMBERSHIP",
+				fmt.Sprintf("no membership record (%s)", submission.MembershipNumber))
+			if err != nil {
+				return err
+			}
 			continue
 		}
 
@@ -116,6 +130,12 @@ func handleTrainingRequest(submissionId string, request jotform_webhook.Training
 
 		memberRecords[entryIndex] = memberRecord
 
+		// check the amount against the price of the session, before the member is asked to pay
+		err = checkAndReportSessionPrice(memberRecord, submission)
+		if err != nil {
+			return err
+		}
+
 		// check that the membership is current, send me a message if not. Inconsistency with the form data
 		// will be flagged with member when update membership data is received
 		submission.ActualCurrMem = membershipDateCheck(memberRecord, &submission.TrainingDate)
@@ -129,10 +149,6 @@ func handleTrainingRequest(submissionId string, request jotform_webhook.Training
 				// time as the membership may have just been renewed
 				sendReceivedRequestEmail = false
 
-				// email me on expired membership incase it's just been renewed
-				emailHandler.SendEmail(testEmail, "Training: REFRESH MEMBERSHIP",
-					fmt.Sprintf("membership check for %s %s (%s) failed",
-						memberRecord.FirstName, memberRecord.LastName, memberRecord.MemberNumber))
 			}
 
 			// update
@@ -141,52 +157,164 @@ func handleTrainingRequest(submissionId string, request jotform_webhook.Training
 				return err
 			}
 
+			if submission.LapsedMembership {
+				// email me on expired membership incase it's just been renewed
+				err = emailHandler.SendEmail(testEmail, "Training: REFRESH MEMBERSHIP",
+					fmt.Sprintf("membership check for %s %s (%s) failed",
+						memberRecord.FirstName, memberRecord.LastName, memberRecord.MemberNumber))
+				if err != nil {
+					return err
+				}
+			}
+
 			continue
 		}
 
-		// TODO:
-		// check that a training entry for the same date/time has not already been received
-		// including the two submissions
-		// Check for submissions by the same member on the same date and include that information in
-		// the email
-
-		// TODO:
-		// check that number of requested (and paid) entries per session and reject the entry if
-		// the numbers are two high
-
-		// TODO:
-		// When numbers are filled by paid submissions, email anyone that has not paid and explain
-		// they are too late.
 	}
 
 	if sendReceivedRequestEmail {
-		emailHandler.SendReceivedRequest(memberRecords, submissions, "")
-	} else {
-		for _, submission := range submissions {
-			submission.ReceivedRequestEmailSent = false
-			err := trainTable.Put(submission, submission.GetID())
-			if err != nil {
-				return err
-			}
+		err = sendReceivedRequest(memberRecords, accepted, strings.TrimSpace(
+			alreadyBookedText(memberRecords, accepted)+" "+priceMismatchText(memberRecords, accepted)))
+		if err != nil {
+			return err
 		}
 	}
 
 	return nil
 }
 
-// membershipDateCheck verifies if a member's membership is valid on a specific target date.
-func membershipDateCheck(member *db.MemberRecord, target *time.Time) bool {
-	start := member.MembershipValidFrom
-	end := member.MembershipValidTo
-	if start == nil {
-		return false
+// checkSessionCapacity splits the entries of a submission into those that can be booked and those for sessions
+// that are already full, which go on the waiting list. Places are held by RECEIVED and PAID submissions, including
+// earlier entries of the same submission. Entries for a member who is already booked at the same time, by another
+// submission or an earlier entry of this one, are flagged as already booked.
+func checkSessionCapacity(submissionId string, submissions []*db.TrainingSubmission) (
+	accepted, waiting []*db.TrainingSubmission, err error) {
+
+	var ownIds []string
+	for entryIndex, submission := range submissions {
+		submission.SetID(makeId(submissionId, entryIndex))
+		ownIds = append(ownIds, submission.GetID())
 	}
-	if end == nil {
-		return false
+
+	for entryIndex, submission := range submissions {
+		sessionBookings, err := getBookingsAt(submission.TrainingDate)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// Ignore any records of this submission already in the db, it could be being reprocessed
+		duplicate := findDuplicateBooking(submission, sessionBookings, ownIds)
+		if duplicate == nil {
+			duplicate = findDuplicateBooking(submission, submissions[:entryIndex], nil)
+		}
+		if duplicate != nil {
+			fmt.Printf("Member %s already booked at %s by submission id %s, submission id %s\n",
+				submission.MembershipNumber, submission.TrainingDate.Format(time.RFC1123), duplicate.GetID(),
+				submission.GetID())
+			submission.AlreadyBooked = true
+			submission.AlreadyBookedSubmissionId = duplicate.GetID()
+		}
+
+		booked := countSessionBookings(submission, sessionBookings, ownIds) +
+			countSessionBookings(submission, accepted, nil)
+
+		if booked >= sessionCapacity(submission.Venue, submission.TrainingDate) {
+			fmt.Printf("Session at %s on %s is full (%d booked), submission id %s\n",
+				submission.Venue, submission.TrainingDate.Format(time.RFC1123), booked, submission.GetID())
+			submission.SubmissionState = db.WaitingSubmissionState
+			waiting = append(waiting, submission)
+			continue
+		}
+		accepted = append(accepted, submission)
+	}
+
+	return accepted, waiting, nil
+}
+
+// alreadyBookedText describes any submissions flagged as already booked, for inclusion in the received request email.
+func alreadyBookedText(members []*db.MemberRecord, submissions []*db.TrainingSubmission) string {
+	var texts []string
+	for i, submission := range submissions {
+		if !submission.AlreadyBooked || i >= len(members) || members[i] == nil {
+			continue
+		}
+		texts = append(texts, fmt.Sprintf("Please note that %s %s is already booked for a session on %s.",
+			members[i].FirstName, members[i].LastName, formatCustomDate(submission.TrainingDate)+" "+
+				formatTime(submission.TrainingDate)))
+	}
+	return strings.Join(texts, " ")
+}
+
+// handleWaitingSubmissions stores submissions for sessions that are full and tells the members they are on the
+// waiting list.
+func handleWaitingSubmissions(waiting []*db.TrainingSubmission) error {
+	for _, submission := range waiting {
+		submission.LinkedSubmissionIds = []string{submission.GetID()}
+		submission.ReceivedRequestEmailSent = false
+
+		memberRecord, err := memberTable.Get(submission.MembershipNumber)
+		if memberRecord == nil || err != nil {
+			submission.FoundMemberRecord = false
+		}
+
+		err = trainTable.Put(submission, submission.GetID())
+		if err != nil {
+			return err
+		}
+
+		if submission.FoundMemberRecord == false {
+			continue
+		}
+
+		// Use test email address if in test mode
+		if testMode {
+			memberRecord.Email = testEmail
+		}
+
+		err = emailHandler.SendSessionFull(memberRecord, submission)
+		if err != nil {
+			return err
+		}
 	}
+	return nil
+}
+
+// membershipOn finds the membership period that covers a target date, preferring the one that runs latest when
+// several do. Members imported before membership periods were stored are checked against their single set of
+// membership dates.
+func membershipOn(member *db.MemberRecord, target *time.Time) *db.MembershipPeriod {
 	if target == nil {
-		return false
+		return nil
 	}
-	return (target.Equal(*start) || target.After(*start)) &&
-		(target.Equal(*end) || target.Before(*end))
+
+	periods := member.Memberships
+	if len(periods) == 0 {
+		periods = []db.MembershipPeriod{{
+			Type:      member.MembershipType,
+			Status:    member.ClubMembershipStatus,
+			ValidFrom: member.MembershipValidFrom,
+			ValidTo:   member.MembershipValidTo,
+		}}
+	}
+
+	var result *db.MembershipPeriod
+	for i, period := range periods {
+		start := period.ValidFrom
+		end := period.ValidTo
+		if start == nil || end == nil {
+			continue
+		}
+		if (target.Equal(*start) || target.After(*start)) &&
+			(target.Equal(*end) || target.Before(*end)) {
+			if result == nil || end.After(*result.ValidTo) {
+				result = &periods[i]
+			}
+		}
+	}
+	return result
+}
+
+// membershipDateCheck verifies if a member's membership is valid on a specific target date.
+func membershipDateCheck(member *db.MemberRecord, target *time.Time) bool {
+	return membershipOn(member, target) != nil
 }
@@ -7,12 +7,21 @@ import (
 	"fmt"
 )
 
-// handleTrainingAdmin processes administrative uploads from Jotform, such as transaction or member CSV files.
+// handleTrainingAdmin processes administrative uploads from Jotform, such as transaction or member CSV files, manual
+// payment allocations and sent email lookups.
 func handleTrainingAdmin(form *jotform_webhook.FormData, request jotform_webhook.TrainingAdminRawRequest) error {
 
 	var errs []error
 	var err error
 
+	if request.AllocationAction != "" {
+		return handlePaymentOverride(request.AllocationAction, request.AllocateTransaction, request.AllocateTo)
+	}
+
+	if request.EmailLookup != "" {
+		return handleEmailLookup(request.EmailLookup)
+	}
+
 	// process just the first uploaded file, there should only be one
 	if len(request.UploadURLs) == 0 {
 		err = fmt.Errorf("no uploaded files for form %v", form.DebugString())
@@ -34,7 +43,7 @@ func handleTrainingAdmin(form *jotform_webhook.FormData, request jotform_webhook
 	var transactions []*db.TransactionRecord
 	var members []*db.MemberRecord
 
-	transactions, err = parseTransactionsCSV(uploadedCSVData)
+	transactions, err = parseBankStatement(uploadedCSVData)
 	if err != nil {
 		errs = append(errs, fmt.Errorf("failed transaction parsing: %w", err))
 		members, err = parseMembersCSV(uploadedCSVData)
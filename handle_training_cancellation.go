@@ -0,0 +1,152 @@
+package main
+
+import (
+	"benjitucker/bathrc-accounts/db"
+	"benjitucker/bathrc-accounts/jotform-webhook"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// cancellationCutOff is how long before a session a paid booking must be cancelled for a refund or credit to be due.
+// It can be replaced by the "training-cancellation-cutoff" parameter, e.g. "48h".
+var cancellationCutOff = time.Hour * 48
+
+// findCancelledSubmission finds the submission a cancellation request refers to, by payment reference, session and
+// membership number, narrowed by venue when it was given. The membership number must be the booking's, so only the
+// member who made a booking can cancel it.
+func findCancelledSubmission(request *jotform_webhook.TrainingCancellationRawRequest,
+	candidates []*db.TrainingSubmission) (*db.TrainingSubmission, error) {
+
+	if request.MembershipNumber == "" {
+		return nil, fmt.Errorf("cancellation for payment reference %s has no membership number",
+			request.PaymentReference)
+	}
+
+	var matches []*db.TrainingSubmission
+	for _, submission := range candidates {
+		if !strings.EqualFold(submission.PaymentReference, request.PaymentReference) ||
+			!submission.TrainingDate.Equal(request.SelectSession.StartLocal) {
+			continue
+		}
+		if request.Venue != "" && submission.Venue != request.Venue {
+			continue
+		}
+		if submission.MembershipNumber != request.MembershipNumber {
+			continue
+		}
+		matches = append(matches, submission)
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("no booking found for payment reference %s on %s for membership number %s",
+			request.PaymentReference, request.SelectSession.StartLocal.Format(time.RFC1123), request.MembershipNumber)
+	case 1:
+		return matches[0], nil
+	default:
+		return nil, fmt.Errorf("%d bookings found for payment reference %s on %s for membership number %s",
+			len(matches), request.PaymentReference, request.SelectSession.StartLocal.Format(time.RFC1123),
+			request.MembershipNumber)
+	}
+}
+
+// isRefundDue reports whether cancelling a submission at the given time entitles the member to a refund or credit of
+// what they have paid, in full or in part.
+func isRefundDue(submission *db.TrainingSubmission, cancelled time.Time) bool {
+	return submission.PaymentReceived() &&
+		cancelled.Before(submission.TrainingDate.Add(-cancellationCutOff))
+}
+
+// handleTrainingCancellation processes a member's cancellation of a booked training session. The place is freed for
+// the waiting list by the next hourly run.
+func handleTrainingCancellation(request *jotform_webhook.TrainingCancellationRawRequest) error {
+	now := time.Now()
+
+	var candidates []*db.TrainingSubmission
+	for _, state := range []string{db.ReceivedSubmissionState, db.PaidSubmissionState, db.WaitingSubmissionState} {
+		subs, err := trainTable.GetAllOfStateRecent(state, now)
+		if err != nil {
+			return err
+		}
+		candidates = append(candidates, subs...)
+	}
+
+	submission, err := findCancelledSubmission(request, candidates)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("cancelling submission id %s (ref:%s)\n", submission.GetID(), submission.PaymentReference)
+
+	// A submission not paid in full is removed from its set so the rest of the set can still be paid for
+	if submission.PaymentRecordId == "" {
+		err = unlinkSubmission(submission, candidates)
+		if err != nil {
+			return err
+		}
+	}
+	// Credit used towards a submission with nothing paid is given back, payments are only refunded before the cut off
+	if !submission.PaymentReceived() {
+		err = returnAppliedCredit(submission)
+		if err != nil {
+			return err
+		}
+	}
+
+	submission.SubmissionState = db.CancelledSubmissionState
+	submission.CancelledDate = now
+	submission.RefundDue = isRefundDue(submission, now)
+	err = trainTable.Put(submission, submission.GetID())
+	if err != nil {
+		return err
+	}
+
+	if submission.RefundDue {
+		err = recordCancellationCredit(submission)
+		if err != nil {
+			return err
+		}
+	}
+
+	member, err := memberTable.Get(submission.MembershipNumber)
+	if err != nil || member == nil {
+		return fmt.Errorf("cancelled submission id %s has no member record (%s)",
+			submission.GetID(), submission.MembershipNumber)
+	}
+
+	// Use test email address if in test mode
+	if testMode {
+		member.Email = testEmail
+	}
+
+	err = emailHandler.SendCancellation(member, submission, formatDuration(cancellationCutOff))
+	if err != nil {
+		return err
+	}
+
+	if submission.RefundDue {
+		return emailHandler.SendEmail(testEmail, "Training: Refund due on cancellation",
+			fmt.Sprintf("Payment ref %s, member %s %s (%s), refund or credit of %s due",
+				submission.PaymentReference, member.FirstName, member.LastName, member.MemberNumber,
+				formatAmount(cancellationCreditPence(submission))))
+	}
+
+	return nil
+}
+
+// formatDuration formats a duration in whole hours or days for member emails.
+func formatDuration(d time.Duration) string {
+	hours := int(d.Hours())
+	if hours%24 == 0 && hours >= 24 {
+		days := hours / 24
+		if days == 1 {
+			return "1 day"
+		}
+		return fmt.Sprintf("%d days", days)
+	}
+	if hours == 1 {
+		return "1 hour"
+	}
+	return fmt.Sprintf("%d hours", hours)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"benjitucker/bathrc-accounts/db"
+	"benjitucker/bathrc-accounts/jotform-webhook"
+	"testing"
+	"time"
+)
+
+func TestFindCancelledSubmission(t *testing.T) {
+	session := time.Date(2026, 5, 1, 19, 0, 0, 0, time.UTC)
+
+	newSub := func(id, ref, member string, date time.Time) *db.TrainingSubmission {
+		sub := &db.TrainingSubmission{
+			PaymentReference: ref,
+			MembershipNumber: member,
+			Venue:            "Widbrook",
+			TrainingDate:     date,
+		}
+		sub.SetID(id)
+		return sub
+	}
+
+	candidates := []*db.TrainingSubmission{
+		newSub("1-0", "ABCD", "M1", session),
+		newSub("1-1", "ABCD", "M2", session),
+		newSub("1-2", "ABCD", "M1", session.Add(time.Hour)),
+		newSub("2-0", "WXYZ", "M3", session),
+	}
+
+	request := &jotform_webhook.TrainingCancellationRawRequest{
+		PaymentReference: "abcd",
+		Venue:            "Widbrook",
+		SelectSession:    jotform_webhook.Session{StartLocal: session},
+	}
+
+	if _, err := findCancelledSubmission(request, candidates); err == nil {
+		t.Errorf("expected error for a cancellation without a membership number")
+	}
+
+	// Another member cannot cancel the booking
+	request.MembershipNumber = "M3"
+	if _, err := findCancelledSubmission(request, candidates); err == nil {
+		t.Errorf("expected error for a membership number that is not the booking's")
+	}
+
+	request.MembershipNumber = "M2"
+	got, err := findCancelledSubmission(request, candidates)
+	if err != nil {
+		t.Fatalf("findCancelledSubmission returned error: %v", err)
+	}
+	if got.GetID() != "1-1" {
+		t.Errorf("cancelled %s, want 1-1", got.GetID())
+	}
+
+	request.PaymentReference = "NONE"
+	if _, err := findCancelledSubmission(request, candidates); err == nil {
+		t.Errorf("expected error for unknown reference")
+	}
+}
+
+func TestIsRefundDue(t *testing.T) {
+	session := time.Date(2026, 5, 1, 19, 0, 0, 0, time.UTC)
+	paid := &db.TrainingSubmission{TrainingDate: session, PaymentRecordId: "P1"}
+	unpaid := &db.TrainingSubmission{TrainingDate: session}
+
+	early := session.Add(-cancellationCutOff - time.Hour)
+	late := session.Add(-cancellationCutOff + time.Hour)
+
+	if !isRefundDue(paid, early) {
+		t.Errorf("expected refund for early cancellation")
+	}
+	if isRefundDue(paid, late) {
+		t.Errorf("expected no refund for late cancellation")
+	}
+	if isRefundDue(unpaid, early) {
+		t.Errorf("expected no refund for unpaid submission")
+	}
+
+	// Part payments are refunded under the same cut off
+	partPaid := &db.TrainingSubmission{TrainingDate: session, AmountPence: 2500, CreditAppliedPence: 500,
+		Allocations: []db.PaymentAllocation{{TransactionId: "T1", AmountPence: 1000}}}
+	if !isRefundDue(partPaid, early) || isRefundDue(partPaid, late) {
+		t.Errorf("expected a refund for a part paid submission only before the cut off")
+	}
+	if got := cancellationCreditPence(partPaid); got != 1500 {
+		t.Errorf("expected the part payment and credit to be owed, got %d", got)
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	tests := map[time.Duration]string{
+		time.Hour * 48: "2 days",
+		time.Hour * 24: "1 day",
+		time.Hour * 36: "36 hours",
+		time.Hour:      "1 hour",
+	}
+	for d, want := range tests {
+		if got := formatDuration(d); got != want {
+			t.Errorf("formatDuration(%v) = %q, want %q", d, got, want)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"benjitucker/bathrc-accounts/db"
+	"errors"
 	"strconv"
 	"strings"
 	"testing"
@@ -47,12 +48,16 @@ func TestWriteEmail_BuildsSubjectAndCSVBody(t *testing.T) {
 	var gotSubject string
 	var gotBody string
 
-	emailer := func(subject, body string) {
+	emailer := func(subject, body string) error {
 		gotSubject = subject
 		gotBody = body
+		return nil
 	}
 
-	writeEmail(transactions, submissions, twoMonthsAgo, emailer)
+	err := writeEmail(transactions, submissions, nil, twoMonthsAgo, emailer)
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	// -------- SUBJECT ASSERTION --------
 	expectedSubjectPrefix := "Transactions summary since "
@@ -157,12 +162,16 @@ func TestWriteEmail_FullCoverage(t *testing.T) {
 	var gotSubject string
 	var gotBody string
 
-	emailer := func(subject, body string) {
+	emailer := func(subject, body string) error {
 		gotSubject = subject
 		gotBody = body
+		return nil
 	}
 
-	writeEmail(transactions, submissions, twoMonthsAgo, emailer)
+	err := writeEmail(transactions, submissions, nil, twoMonthsAgo, emailer)
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	// ---------- SUBJECT ----------
 	expectedSubjectPrefix := "Transactions summary since "
@@ -209,3 +218,14 @@ func TestWriteEmail_FullCoverage(t *testing.T) {
 		t.Errorf("expected tx3 line to end with reference REF789, got %q", tx3Line)
 	}
 }
+
+func TestWriteEmail_ReturnsSendError(t *testing.T) {
+	sendErr := errors.New("throttled")
+	err := writeEmail(nil, nil, nil, time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC),
+		func(subject, body string) error {
+			return sendErr
+		})
+	if !errors.Is(err, sendErr) {
+		t.Errorf("expected the send error, got %v", err)
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"benjitucker/bathrc-accounts/db"
 	"fmt"
 	"log"
+	"slices"
+	"sort"
 	"strings"
 	"time"
 
@@ -22,19 +24,32 @@ func formatAmount(amountPence int64) string {
 // handleTransactions processes new transaction records, updates the database, and matches them against training submissions to mark them as paid.
 func handleTransactions(records []*db.TransactionRecord) error {
 
-	emailHandler.SendEmail(testEmail, "jotform webhook: Training Admin",
-		fmt.Sprintf("Handle %d transactions\n", len(records)))
+	balanceWarning, err := checkStatementBalances(records)
+	if err != nil {
+		return err
+	}
 
-	err := transactionTable.PutAll(records)
+	imported, err := classifyTransactions(records, transactionTable.Get)
 	if err != nil {
 		return err
 	}
 
-	fmt.Printf("added/updated %d transactions", len(records))
+	report := imported.String()
+	if balanceWarning != "" {
+		report = balanceWarning + "\n\n" + report
+	}
+	err = emailHandler.SendEmail(testEmail, "jotform webhook: Training Admin", report)
+	if err != nil {
+		return err
+	}
 
-	// TODO:
-	// Check the number of paid entries per session and reject the latest ones if the numbers are too
-	// high
+	err = transactionTable.PutAll(imported.New)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("added %d transactions, skipped %d, %d conflicting\n",
+		len(imported.New), len(imported.Skipped), len(imported.Conflicting))
 
 	// Get all the relevant transactions in one request
 	records, err = transactionTable.GetAllOfTypeRecent("CR", time.Now().Add(-recentTransactionsDuration))
@@ -80,112 +95,336 @@ func handleTransactions(records []*db.TransactionRecord) error {
 		return fmt.Errorf("failed to update in-past submissions: %w", err)
 	}
 
-	for _, submission := range receivedSubmissions {
-		if submission.PaymentRecordId != "" {
-			// Could have been updated already as it is linked
-			continue
-		}
+	members, err := getSubmissionMembers(append(receivedSubmissions, paidSubmissions...))
+	if err != nil {
+		return err
+	}
 
-		// Note, continue to process submissions for past events so that we can receive payments
-		// after the event
+	// Transactions may also have been allocated to bookings that have since moved on
+	settledSubmissions, err := getSettledSubmissions(time.Now().Add(-recentTransactionsDuration - latePaymentsDuration))
+	if err != nil {
+		return err
+	}
 
-		var matchedRecord *db.TransactionRecord
-		bestDistance := 1000
-		// Find the closest matching payment
-		for _, record := range records {
-			// not before the submission was made, note the transaction date does not include the time
-			transactionDate := dateOnly(record.Date)
-			submissionDate := dateOnly(submission.RequestDate)
-			if transactionDate.Before(submissionDate) {
-				continue
+	matches, probables := allocatePayments(records, receivedSubmissions,
+		append(paidSubmissions, settledSubmissions...), members)
+
+	for _, match := range matches {
+		for i, set := range match.sets {
+			overpaidPence := int64(0)
+			if i == len(match.sets)-1 {
+				overpaidPence = match.overpaidPence
 			}
-			// not already attached to a submission
-			alreadyAttached := false
-			// Check receivedSubmissions as well because there may be one we have just attached
-			for _, paidSubmission := range append(paidSubmissions, receivedSubmissions...) {
-				if paidSubmission.PaymentRecordId == record.GetID() {
-					alreadyAttached = true
-					break
-				}
+			err = handlePaymentAllocation(match.transaction, set, overpaidPence, receivedSubmissions)
+			if err != nil {
+				return err
 			}
-			if alreadyAttached == true {
+		}
+
+		// store the usage once the sets are stored, until then it is found from their allocations
+		err = transactionTable.Put(match.transaction)
+		if err != nil {
+			return err
+		}
+	}
+
+	return sendReconciliationReport(records, receivedSubmissions, paidSubmissions, probables, members)
+}
+
+// paymentMatch is a transaction and the submission sets it has been allocated to, in the order they were paid.
+type paymentMatch struct {
+	transaction   *db.TransactionRecord
+	sets          [][]*db.TrainingSubmission
+	overpaidPence int64 // left over once every set was paid in full
+}
+
+// getSettledSubmissions returns the submissions for sessions since the given date that are no longer waiting for
+// payment, but may have been allocated payments, e.g. those in the past or cancelled.
+func getSettledSubmissions(since time.Time) ([]*db.TrainingSubmission, error) {
+	var settled []*db.TrainingSubmission
+	for _, state := range []string{db.InPastSubmissionState, db.CancelledSubmissionState,
+		db.ExpiredSubmissionState, db.DroppedSubmissionState} {
+		subs, err := trainTable.GetAllOfStateRecent(state, since)
+		if err != nil {
+			return nil, err
+		}
+		settled = append(settled, subs...)
+	}
+	return settled, nil
+}
+
+// allocatePayments allocates the unused part of each transaction to the unpaid submission sets it matches. A
+// transaction whose description contains the payment references of several sets is split between them, in the order
+// the sets were requested. Sets that are not fully paid keep their allocations and wait for further payments. A set
+// that is paid in full is marked as paid, with PaymentRecordId set to the transaction that completed it.
+//
+// A transaction that matches no reference is matched by the payer's name and exact amount when confident, otherwise
+// it is returned as a probable match for the treasurer to check. Only the unused part of a transaction is allocated,
+// taking account of its allocations to the settled submissions, those that are paid, in the past, cancelled and so on.
+func allocatePayments(transactions []*db.TransactionRecord, received, settled []*db.TrainingSubmission,
+	members map[string]*db.MemberRecord) ([]*paymentMatch, []*probableMatch) {
+
+	updateTransactionUsage(transactions, append(settled, received...))
+	sets := openSubmissionSets(received)
+
+	sorted := slices.Clone(transactions)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Date.Before(sorted[j].Date)
+	})
+
+	var matches []*paymentMatch
+	var probables []*probableMatch
+	for _, transaction := range sorted {
+		remaining := transaction.RemainingPence()
+		if remaining <= 0 {
+			continue
+		}
+
+		matchedSets := matchSubmissionSets(transaction, sets)
+		if len(matchedSets) == 0 {
+			set, probable := matchByName(transaction, remaining, sets, members)
+			if set == nil {
+				probables = append(probables, probable...)
 				continue
 			}
-			// Find the best match
-			distance := calcDistance(submission, record)
-			if distance < bestDistance {
-				bestDistance = distance
-				matchedRecord = record
+			log.Printf("Matched payment %s to ref %s by name", transaction.String(), set[0].PaymentReference)
+			matchedSets = [][]*db.TrainingSubmission{set}
+		}
+
+		match := &paymentMatch{transaction: transaction}
+		for _, set := range matchedSets {
+			if remaining == 0 {
+				break
 			}
-			log.Printf("Received Submission ID %s (ref:%s), payment %s, distance %d",
-				submission.GetID(), submission.PaymentReference, record.String(), distance)
+			remaining -= allocateToSet(transaction, set, remaining)
+			match.sets = append(match.sets, set)
+		}
+		match.overpaidPence = remaining
+		matches = append(matches, match)
+
+		// Fully paid sets are no longer open
+		sets = slices.DeleteFunc(sets, func(set []*db.TrainingSubmission) bool {
+			return setAmountDue(set) == 0
+		})
+	}
+	return matches, probables
+}
+
+// updateTransactionUsage brings the usage stored on the transactions up to date with the allocations on the
+// submissions. Transactions allocated before their usage was stored on them only have it on their submissions.
+func updateTransactionUsage(transactions []*db.TransactionRecord, submissions []*db.TrainingSubmission) {
+	used, consumed := transactionUsage(submissions)
+	for _, transaction := range transactions {
+		transaction.UsedPence = max(transaction.UsedPence, used[transaction.GetID()])
+		transaction.Consumed = transaction.Consumed || consumed[transaction.GetID()]
+	}
+}
+
+// transactionUsage returns how much of each transaction has been allocated to the submissions, and which
+// transactions have been used up. A transaction that completed the payment of a set is used up, any overpayment
+// having been recorded as credit.
+func transactionUsage(submissions []*db.TrainingSubmission) (map[string]int64, map[string]bool) {
+	used := make(map[string]int64)
+	consumed := make(map[string]bool)
+	for _, submission := range submissions {
+		for _, allocation := range submission.Allocations {
+			used[allocation.TransactionId] += allocation.AmountPence
+		}
+		if submission.PaymentRecordId != "" {
+			consumed[submission.PaymentRecordId] = true
 		}
+	}
+	return used, consumed
+}
 
-		// If not exact match, allow just one character of difference
-		if bestDistance > 2 || matchedRecord == nil {
-			// No match
+// openSubmissionSets groups the unpaid submissions into their linked sets, in the order they were received.
+func openSubmissionSets(received []*db.TrainingSubmission) [][]*db.TrainingSubmission {
+	var sets [][]*db.TrainingSubmission
+	seen := make(map[string]bool)
+	for _, submission := range received {
+		if seen[submission.GetID()] || submission.PaymentRecordId != "" {
 			continue
 		}
+		var set []*db.TrainingSubmission
+		for _, linked := range received {
+			if slices.Contains(submission.LinkedSubmissionIds, linked.GetID()) && !seen[linked.GetID()] {
+				seen[linked.GetID()] = true
+				set = append(set, linked)
+			}
+		}
+		if len(set) == 0 || setAmountDue(set) <= 0 {
+			continue
+		}
+		sets = append(sets, set)
+	}
+	return sets
+}
 
-		linkedMemberRecords, linkedSubmissions, err := findSubmissionSet(submission.LinkedSubmissionIds, receivedSubmissions)
-		if err != nil {
-			return err
+// matchSubmissionSets returns the sets a transaction pays for. These are all the sets whose payment reference appears
+// in the description or, failing that, the closest match allowing just one character of difference.
+func matchSubmissionSets(transaction *db.TransactionRecord, sets [][]*db.TrainingSubmission) [][]*db.TrainingSubmission {
+	var exact [][]*db.TrainingSubmission
+	var closest []*db.TrainingSubmission
+	bestDistance := 1000
+	for _, set := range sets {
+		// not before the submission was made, note the transaction date does not include the time
+		if dateOnly(transaction.Date).Before(dateOnly(set[0].RequestDate)) {
+			continue
+		}
+		// not detached from the set by the treasurer
+		if slices.Contains(set[0].RejectedTransactionIds, transaction.GetID()) {
+			continue
+		}
+		distance := calcDistance(set[0], transaction)
+		log.Printf("Received Submission ID %s (ref:%s), payment %s, distance %d",
+			set[0].GetID(), set[0].PaymentReference, transaction.String(), distance)
+		if distance == 0 {
+			exact = append(exact, set)
+		}
+		if distance < bestDistance {
+			bestDistance = distance
+			closest = set
+		}
+	}
+
+	if len(exact) > 0 {
+		return exact
+	}
+	// If not exact match, allow just one character of difference
+	if bestDistance > 2 || closest == nil {
+		return nil
+	}
+	return [][]*db.TrainingSubmission{closest}
+}
+
+func setAmountDue(set []*db.TrainingSubmission) int64 {
+	var due int64
+	for _, submission := range set {
+		due += submission.AmountDuePence()
+	}
+	return due
+}
+
+// allocateToSet allocates up to the available amount of a transaction to the submissions of a set, marking the set
+// paid if that completes it. The usage is recorded on the transaction too, so it is still known once the set has
+// moved on, e.g. to in past or cancelled. It returns the amount allocated.
+func allocateToSet(transaction *db.TransactionRecord, set []*db.TrainingSubmission, available int64) int64 {
+	var allocated int64
+	for _, submission := range set {
+		amount := min(submission.AmountDuePence(), available-allocated)
+		if amount <= 0 {
+			continue
 		}
+		submission.Allocations = append(submission.Allocations, db.PaymentAllocation{
+			TransactionId: transaction.GetID(),
+			AmountPence:   amount,
+		})
+		allocated += amount
+	}
+	transaction.UsedPence += allocated
 
-		var problemTexts []string
-		var totalAmount int64
-		lapsedMembership := false
-		for _, linkedSubmission := range linkedSubmissions {
-			// update state
-			linkedSubmission.PaymentRecordId = matchedRecord.GetID()
+	if setAmountDue(set) == 0 {
+		transaction.Consumed = true
+		for _, submission := range set {
+			submission.PaymentRecordId = transaction.GetID()
 
 			// It could be a past submission so in that case don't update to paid state
-			if linkedSubmission.SubmissionState == db.ReceivedSubmissionState {
-				linkedSubmission.SubmissionState = db.PaidSubmissionState
+			if submission.SubmissionState == db.ReceivedSubmissionState {
+				submission.SubmissionState = db.PaidSubmissionState
 			}
+		}
+	}
+	return allocated
+}
+
+// handlePaymentAllocation stores a set after a transaction has been allocated to it and emails the members, either
+// confirming the booking or telling them how much is still to be paid.
+func handlePaymentAllocation(transaction *db.TransactionRecord, set []*db.TrainingSubmission, overpaidPence int64,
+	receivedSubmissions []*db.TrainingSubmission) error {
 
-			// calc total for check
-			totalAmount = totalAmount + linkedSubmission.AmountPence
+	linkedMemberRecords, linkedSubmissions, err := findSubmissionSet(set[0].LinkedSubmissionIds, receivedSubmissions)
+	if err != nil {
+		return err
+	}
 
-			// check lapsed
-			if linkedSubmission.LapsedMembership {
-				lapsedMembership = true
+	allocatedPence := int64(0)
+	for _, submission := range linkedSubmissions {
+		for _, allocation := range submission.Allocations {
+			if allocation.TransactionId == transaction.GetID() {
+				allocatedPence += allocation.AmountPence
 			}
 		}
-		if lapsedMembership == true {
-			problemTexts = append(problemTexts, fmt.Sprintf(
-				`Your membership runs out before the training session. Please renew your memebrship with Sport80.`))
+	}
+
+	if set[0].PaymentRecordId == "" {
+		// Part payment, wait for the rest
+		fmt.Printf("part payment of %s for ref %s, %s outstanding\n", formatAmount(allocatedPence),
+			set[0].PaymentReference, formatAmount(setAmountDue(linkedSubmissions)))
+
+		// store the payment before telling the members, so it is kept if the email fails
+		err = trainTable.PutAll(linkedSubmissions)
+		if err != nil {
+			return err
 		}
 
-		if totalAmount != matchedRecord.AmountPence {
-			for _, sub := range linkedSubmissions {
-				sub.PaymentDiscrepancy = true
-			}
+		return emailHandler.SendProblemMessage(linkedMemberRecords, set[0], fmt.Sprintf(`
+A payment of %s has been received towards this request, reference %s. A further %s is still to be paid using the
+same reference before the sessions are booked.
+`, formatAmount(allocatedPence), set[0].PaymentReference, formatAmount(setAmountDue(linkedSubmissions))))
+	}
+
+	var problemTexts []string
+	lapsedMembership := false
+	for _, linkedSubmission := range linkedSubmissions {
+		// check lapsed
+		if linkedSubmission.LapsedMembership {
+			lapsedMembership = true
+		}
+	}
+	if lapsedMembership == true {
+		problemTexts = append(problemTexts, fmt.Sprintf(
+			`Your membership runs out before the training session. Please renew your memebrship with Sport80.`))
+	}
 
-			problemTexts = append(problemTexts, fmt.Sprintf(
-				`The payment amount is incorrect. The requested session[s] total price is %s, payment received %s.`,
-				formatAmount(totalAmount), formatAmount(matchedRecord.AmountPence)))
+	if overpaidPence > 0 {
+		for _, sub := range linkedSubmissions {
+			sub.PaymentDiscrepancy = true
 		}
 
-		// send received payment emails
-		emailHandler.SendReceivedPayment(linkedMemberRecords, linkedSubmissions, problemTexts)
+		problemTexts = append(problemTexts, fmt.Sprintf(
+			`The payment amount is incorrect. The payment received of %s was %s more than the price of the requested session[s]. The difference has been kept as credit.`,
+			formatAmount(transaction.AmountPence), formatAmount(overpaidPence)))
 
-		// update linked submissions
-		err = trainTable.PutAll(linkedSubmissions)
+		// record what is owed to the member
+		err = recordPaymentDiscrepancy(transaction, linkedSubmissions, transaction.AmountPence-overpaidPence)
 		if err != nil {
 			return err
 		}
+	}
 
-		for _, sub := range linkedSubmissions {
-			if sub.FoundMemberRecord == false {
-				// email me on payment received when the membership is invalid
-				emailHandler.SendEmail(testEmail, "Training: Paid but bad member",
-					fmt.Sprintf("Payment ref %s, total amount %s bad member number %s",
-						sub.PaymentReference, formatAmount(matchedRecord.AmountPence), sub.MembershipNumber))
+	// update linked submissions, before the emails so the payment is kept if they fail
+	err = trainTable.PutAll(linkedSubmissions)
+	if err != nil {
+		return err
+	}
+
+	// send received payment emails
+	err = emailHandler.SendReceivedPayment(linkedMemberRecords, linkedSubmissions, problemTexts)
+	if err != nil {
+		return err
+	}
+
+	for _, sub := range linkedSubmissions {
+		if sub.FoundMemberRecord == false {
+			// email me on payment received when the membership is invalid
+			err = emailHandler.SendEmail(testEmail, "Training: Paid but bad member",
+				fmt.Sprintf("Payment ref %s, total amount %s bad member number %s",
+					sub.PaymentReference, formatAmount(transaction.AmountPence), sub.MembershipNumber))
+			if err != nil {
+				return err
 			}
 		}
 	}
-
 	return nil
 }
 
@@ -44,7 +44,13 @@ func handleTransactionsSummary() error {
 		return err
 	}
 
-	allSubmissions := append(inPastSubmissions, append(paidSubmissions, append(receivedSubmissions, droppedSubmissions...)...)...)
+	cancelledSubmissions, err := trainTable.GetAllOfStateRecent(db.CancelledSubmissionState, twoMonthsAgo)
+	if err != nil {
+		return err
+	}
+
+	allSubmissions := append(inPastSubmissions, append(paidSubmissions, append(receivedSubmissions,
+		append(droppedSubmissions, cancelledSubmissions...)...)...)...)
 
 	// Get the last 2 months of transactions, sorted by date
 	var transactions []*db.TransactionRecord
@@ -60,15 +66,24 @@ func handleTransactionsSummary() error {
 		return transactions[i].Date.Before(transactions[j].Date)
 	})
 
-	writeEmail(transactions, allSubmissions, twoMonthsAgo, func(subject, body string) {
-		emailHandler.SendEmail(testEmail, subject, body)
+	credits, err := creditTable.GetAll()
+	if err != nil {
+		return err
+	}
+	balances, err := outstandingBalances(credits, memberTable.Get)
+	if err != nil {
+		return err
+	}
+
+	return writeEmail(transactions, allSubmissions, balances, twoMonthsAgo, func(subject, body string) error {
+		return emailHandler.SendEmail(testEmail, subject, body)
 	})
-	return nil
 }
 
-// writeEmail constructs and sends a CSV-formatted summary email of transactions and linked submissions.
+// writeEmail constructs and sends a CSV-formatted summary email of transactions and linked submissions, followed by
+// the outstanding member balances.
 func writeEmail(transactions []*db.TransactionRecord, allSubmissions []*db.TrainingSubmission,
-	twoMonthsAgo time.Time, emailer func(subject, body string)) {
+	balances []*memberBalance, twoMonthsAgo time.Time, emailer func(subject, body string) error) error {
 
 	builder := new(strings.Builder)
 	_, _ = fmt.Fprintf(builder, "Transactions CSV since %s\n\n", formatCustomDate(twoMonthsAgo))
@@ -80,12 +95,18 @@ func writeEmail(transactions []*db.TransactionRecord, allSubmissions []*db.Train
 		notes := ""
 		foundPayment := false
 		for _, submission := range allSubmissions {
-			if submission.PaymentRecordId == transaction.GetID() {
+			if submission.PaidBy(transaction.GetID()) {
 				foundPayment = true
 				submissions = append(submissions, submission)
 				if submission.PaymentDiscrepancy {
 					notes = notes + " Payment Discrepancy, Member " + submission.MembershipNumber
 				}
+				if submission.PaymentRecordId == "" {
+					notes = notes + " Part Payment, Member " + submission.MembershipNumber
+				}
+				if submission.SubmissionState == db.CancelledSubmissionState && submission.RefundDue {
+					notes = notes + " Cancelled Refund Due, Member " + submission.MembershipNumber
+				}
 			}
 		}
 		if !foundPayment {
@@ -96,7 +117,15 @@ func writeEmail(transactions []*db.TransactionRecord, allSubmissions []*db.Train
 
 	}
 
-	emailer(fmt.Sprintf("Transactions summary since %s", formatCustomDate(twoMonthsAgo)), builder.String())
+	if len(balances) > 0 {
+		_, _ = fmt.Fprintf(builder, "\nOutstanding member balances (positive is owed to the member)\n\n")
+		for _, balance := range balances {
+			_, _ = fmt.Fprintf(builder, "%s,%s,%s\n",
+				balance.MemberNumber, balance.Name, formatPounds(balance.BalancePence))
+		}
+	}
+
+	return emailer(fmt.Sprintf("Transactions summary since %s", formatCustomDate(twoMonthsAgo)), builder.String())
 }
 
 // helper to format int64 pence to "123.45" or "-10.01"
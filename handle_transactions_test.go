@@ -3,6 +3,7 @@ package main
 import (
 	"benjitucker/bathrc-accounts/db"
 	"testing"
+	"time"
 )
 
 func Test_calcDistance(t *testing.T) {
@@ -120,3 +121,152 @@ func Test_calcDistance(t *testing.T) {
 		})
 	}
 }
+
+func newAllocationTestSubmission(id, ref string, amountPence int64, linked ...string) *db.TrainingSubmission {
+	sub := &db.TrainingSubmission{
+		SubmissionState:     db.ReceivedSubmissionState,
+		PaymentReference:    ref,
+		AmountPence:         amountPence,
+		RequestDate:         time.Date(2026, 4, 1, 10, 0, 0, 0, time.UTC),
+		LinkedSubmissionIds: linked,
+	}
+	sub.SetID(id)
+	return sub
+}
+
+func newAllocationTestTransaction(id, description string, amountPence int64, day int) *db.TransactionRecord {
+	record := &db.TransactionRecord{
+		Description: description,
+		AmountPence: amountPence,
+		Date:        time.Date(2026, 4, day, 0, 0, 0, 0, time.UTC),
+	}
+	record.SetID(id)
+	return record
+}
+
+func TestAllocatePayments_Instalments(t *testing.T) {
+	sub1 := newAllocationTestSubmission("1-0", "ABCD", 2500, "1-0", "1-1")
+	sub2 := newAllocationTestSubmission("1-1", "ABCD", 2500, "1-0", "1-1")
+	received := []*db.TrainingSubmission{sub1, sub2}
+
+	first := newAllocationTestTransaction("T1", "ABCD", 3000, 2)
+	matches, _ := allocatePayments([]*db.TransactionRecord{first}, received, nil, nil)
+
+	if len(matches) != 1 || len(matches[0].sets) != 1 {
+		t.Fatalf("expected one match with one set, got %+v", matches)
+	}
+	if sub1.PaymentRecordId != "" || sub1.SubmissionState != db.ReceivedSubmissionState {
+		t.Errorf("expected set to remain unpaid after first instalment")
+	}
+	if sub1.AmountDuePence()+sub2.AmountDuePence() != 2000 {
+		t.Errorf("expected £20 outstanding, got %d", sub1.AmountDuePence()+sub2.AmountDuePence())
+	}
+
+	// The first transaction is seen again along with the second instalment
+	second := newAllocationTestTransaction("T2", "ABCD", 2000, 3)
+	matches, _ = allocatePayments([]*db.TransactionRecord{first, second}, received, nil, nil)
+
+	if len(matches) != 1 || matches[0].transaction != second {
+		t.Fatalf("expected only the second transaction to be allocated, got %+v", matches)
+	}
+	for _, sub := range received {
+		if sub.SubmissionState != db.PaidSubmissionState || sub.PaymentRecordId != "T2" {
+			t.Errorf("expected %s paid by T2, got state %s record %s",
+				sub.GetID(), sub.SubmissionState, sub.PaymentRecordId)
+		}
+		if sub.AmountDuePence() != 0 {
+			t.Errorf("expected nothing due on %s, got %d", sub.GetID(), sub.AmountDuePence())
+		}
+	}
+	if !sub2.PaidBy("T1") || !sub2.PaidBy("T2") {
+		t.Errorf("expected the second submission to be paid by both transactions, got %+v", sub2.Allocations)
+	}
+	if matches[0].overpaidPence != 0 {
+		t.Errorf("expected no overpayment, got %d", matches[0].overpaidPence)
+	}
+}
+
+func TestAllocatePayments_SplitTransaction(t *testing.T) {
+	setA := newAllocationTestSubmission("1-0", "ABCD", 2500, "1-0")
+	setB := newAllocationTestSubmission("2-0", "WXYZ", 3000, "2-0")
+	other := newAllocationTestSubmission("3-0", "PQRS", 2500, "3-0")
+	received := []*db.TrainingSubmission{setA, setB, other}
+
+	transaction := newAllocationTestTransaction("T1", "J SMITH ABCD WXYZ", 6000, 2)
+	matches, _ := allocatePayments([]*db.TransactionRecord{transaction}, received, nil, nil)
+
+	if len(matches) != 1 || len(matches[0].sets) != 2 {
+		t.Fatalf("expected the transaction to be split across two sets, got %+v", matches)
+	}
+	if setA.PaymentRecordId != "T1" || setB.PaymentRecordId != "T1" {
+		t.Errorf("expected both sets paid by T1")
+	}
+	if other.PaymentRecordId != "" || len(other.Allocations) != 0 {
+		t.Errorf("expected unrelated set to be untouched")
+	}
+	if matches[0].overpaidPence != 500 {
+		t.Errorf("expected £5 overpaid, got %d", matches[0].overpaidPence)
+	}
+
+	// Used up, so not allocated again
+	matches, _ = allocatePayments([]*db.TransactionRecord{transaction}, []*db.TrainingSubmission{other},
+		[]*db.TrainingSubmission{setA, setB}, nil)
+	if len(matches) != 0 {
+		t.Errorf("expected used transaction to be ignored, got %+v", matches)
+	}
+}
+
+func TestAllocatePayments_FuzzyAndDates(t *testing.T) {
+	sub := newAllocationTestSubmission("1-0", "ABCD", 2500, "1-0")
+
+	// Before the request was made
+	early := newAllocationTestTransaction("T0", "ABCD", 2500, 1)
+	early.Date = time.Date(2026, 3, 31, 0, 0, 0, 0, time.UTC)
+	// Too different
+	wrong := newAllocationTestTransaction("T1", "**BBCF++", 2500, 2)
+	// One character out
+	nearly := newAllocationTestTransaction("T2", "some text ADCD more text", 2500, 3)
+
+	matches, _ := allocatePayments([]*db.TransactionRecord{nearly, wrong, early},
+		[]*db.TrainingSubmission{sub}, nil, nil)
+
+	if len(matches) != 1 || matches[0].transaction != nearly {
+		t.Fatalf("expected only the close match to be allocated, got %+v", matches)
+	}
+	if sub.PaymentRecordId != "T2" {
+		t.Errorf("expected submission paid by T2, got %q", sub.PaymentRecordId)
+	}
+}
+
+func TestAllocatePayments_CancelledPartPayment(t *testing.T) {
+	cancelled := newAllocationTestSubmission("1-0", "ABCD", 5000, "1-0")
+	transaction := newAllocationTestTransaction("T1", "ABCD", 3000, 2)
+
+	matches, _ := allocatePayments([]*db.TransactionRecord{transaction}, []*db.TrainingSubmission{cancelled}, nil, nil)
+	if len(matches) != 1 || transaction.UsedPence != 3000 || transaction.Consumed {
+		t.Fatalf("expected the part payment to be recorded on the transaction, used %d consumed %v",
+			transaction.UsedPence, transaction.Consumed)
+	}
+
+	// The set is cancelled, and its part payment returned as credit, so it is no longer passed in. The transaction
+	// must not be allocated again to another booking with the same reference.
+	cancelled.SubmissionState = db.CancelledSubmissionState
+	next := newAllocationTestSubmission("2-0", "ABCD", 3000, "2-0")
+	matches, _ = allocatePayments([]*db.TransactionRecord{transaction}, []*db.TrainingSubmission{next}, nil, nil)
+	if len(matches) != 0 || len(next.Allocations) != 0 {
+		t.Errorf("expected the used transaction to be ignored, got %+v", matches)
+	}
+}
+
+func TestAllocatePayments_LegacyUsage(t *testing.T) {
+	// Allocated before usage was stored on the transaction, so only the submissions record it
+	part := newAllocationTestSubmission("1-0", "ABCD", 5000, "1-0")
+	part.Allocations = []db.PaymentAllocation{{TransactionId: "T1", AmountPence: 3000}}
+	transaction := newAllocationTestTransaction("T1", "ABCD", 3000, 2)
+
+	matches, _ := allocatePayments([]*db.TransactionRecord{transaction}, []*db.TrainingSubmission{part}, nil, nil)
+	if len(matches) != 0 || transaction.UsedPence != 3000 {
+		t.Errorf("expected the usage to be taken from the submissions, used %d, matches %+v",
+			transaction.UsedPence, matches)
+	}
+}
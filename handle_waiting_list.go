@@ -0,0 +1,279 @@
+package main
+
+import (
+	"benjitucker/bathrc-accounts/db"
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// promotedPayDuration is how long a member promoted from the waiting list has to pay
+	promotedPayDuration = time.Hour * 24
+	// unpaidReleaseDuration is how long after the pay by date an unpaid place is held before it is released to the
+	// waiting list
+	unpaidReleaseDuration = time.Hour * 12
+	// paymentReferenceLayout is the layout of the training form's references, such as "ZL44": two letters then two
+	// digits
+	paymentReferenceLayout  = "AA00"
+	paymentReferenceLetters = "ABCDEFGHJKLMNPQRSTUVWXYZ"
+	paymentReferenceDigits  = "0123456789"
+	// paymentReferenceAttempts is how many references are generated looking for one not already in use
+	paymentReferenceAttempts = 100
+)
+
+type sessionKey struct {
+	venue        string
+	trainingDate int64
+}
+
+func sessionKeyOf(submission *db.TrainingSubmission) sessionKey {
+	return sessionKey{venue: submission.Venue, trainingDate: submission.TrainingDate.Unix()}
+}
+
+// planWaitingList works out which unpaid submissions to release and which waiting submissions to promote into free
+// places. Unpaid places are only released for sessions that have members waiting, once the pay reminder has been
+// sent and the pay by date has passed by unpaidReleaseDuration. Waiting submissions are promoted in request order.
+func planWaitingList(now time.Time, received, paid, waiting []*db.TrainingSubmission) (
+	released, promoted []*db.TrainingSubmission) {
+
+	waitingBySession := make(map[sessionKey][]*db.TrainingSubmission)
+	for _, submission := range waiting {
+		key := sessionKeyOf(submission)
+		waitingBySession[key] = append(waitingBySession[key], submission)
+	}
+
+	isReleased := func(submission *db.TrainingSubmission) bool {
+		for _, r := range released {
+			if r.GetID() == submission.GetID() {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Release overdue unpaid submissions, with the rest of their linked set, where there are members waiting
+	for _, submission := range received {
+		if len(waitingBySession[sessionKeyOf(submission)]) == 0 || isReleased(submission) {
+			continue
+		}
+		if submission.PaymentRecordId != "" || submission.PayReminderEmailSent == false ||
+			now.Before(submission.PayByDate.Add(unpaidReleaseDuration)) {
+			continue
+		}
+		for _, linked := range received {
+			for _, linkedId := range submission.LinkedSubmissionIds {
+				if linked.GetID() == linkedId && !isReleased(linked) {
+					released = append(released, linked)
+				}
+			}
+		}
+	}
+
+	booked := make(map[sessionKey]int)
+	for _, submission := range append(received, paid...) {
+		if !isReleased(submission) {
+			booked[sessionKeyOf(submission)]++
+		}
+	}
+
+	// Sort the keys so that promotions happen in a repeatable order
+	var keys []sessionKey
+	for key := range waitingBySession {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].trainingDate != keys[j].trainingDate {
+			return keys[i].trainingDate < keys[j].trainingDate
+		}
+		return keys[i].venue < keys[j].venue
+	})
+
+	for _, key := range keys {
+		sessionWaiting := waitingBySession[key]
+		sort.SliceStable(sessionWaiting, func(i, j int) bool {
+			return sessionWaiting[i].RequestDate.Before(sessionWaiting[j].RequestDate)
+		})
+
+		free := sessionCapacity(key.venue, sessionWaiting[0].TrainingDate) - booked[key]
+		for i := 0; i < free && i < len(sessionWaiting); i++ {
+			promoted = append(promoted, sessionWaiting[i])
+		}
+	}
+
+	return released, promoted
+}
+
+// handleWaitingList releases places held by overdue unpaid submissions and promotes waiting submissions into any free
+// places. It returns the received submissions updated to match.
+func handleWaitingList(received, paid, waiting []*db.TrainingSubmission) ([]*db.TrainingSubmission, error) {
+	now := time.Now()
+	released, promoted := planWaitingList(now, received, paid, waiting)
+
+	if len(released) > 0 {
+		err := releaseSubmissions(released, received)
+		if err != nil {
+			return nil, err
+		}
+
+		var remaining []*db.TrainingSubmission
+		for _, submission := range received {
+			if submission.SubmissionState == db.ReceivedSubmissionState {
+				remaining = append(remaining, submission)
+			}
+		}
+		received = remaining
+	}
+
+	var usedReferences map[string]bool
+	if len(promoted) > 0 {
+		var err error
+		usedReferences, err = getUsedPaymentReferences()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, submission := range promoted {
+		err := promoteSubmission(now, submission, usedReferences)
+		if err != nil {
+			return nil, err
+		}
+		received = append(received, submission)
+	}
+
+	return received, nil
+}
+
+// releaseSubmissions drops unpaid submissions so their places can be given to members on the waiting list.
+func releaseSubmissions(released, received []*db.TrainingSubmission) error {
+	for _, submission := range released {
+		err := returnAppliedCredit(submission)
+		if err != nil {
+			return err
+		}
+		submission.SubmissionState = db.DroppedSubmissionState
+	}
+	err := trainTable.PutAll(released)
+	if err != nil {
+		return err
+	}
+
+	emailed := make(map[string]bool)
+	for _, submission := range released {
+		if emailed[submission.GetID()] {
+			continue
+		}
+		linkedMemberRecords, linkedSubmissions, err := findSubmissionSet(submission.LinkedSubmissionIds, received)
+		if err != nil {
+			return err
+		}
+		for _, sub := range linkedSubmissions {
+			emailed[sub.GetID()] = true
+		}
+
+		fmt.Printf("releasing unpaid submission id %s and linked to the waiting list\n", submission.GetID())
+
+		err = emailHandler.SendProblemMessage(linkedMemberRecords, submission, fmt.Sprintf(`
+Payment for this request, reference %s, was not received by the pay by date and the place has been given to a rider
+on the waiting list. This means that no sessions have been booked for you. Please do not make a payment for this
+request.
+`, submission.PaymentReference))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// promoteSubmission moves a submission from the waiting list into a free place and emails the member the payment
+// details. The promoted submission is given its own payment reference, as the rest of its original request may
+// already have been paid with the original reference.
+func promoteSubmission(now time.Time, submission *db.TrainingSubmission, usedReferences map[string]bool) error {
+	reference, err := newUnusedPaymentReference(usedReferences)
+	if err != nil {
+		return err
+	}
+
+	payBy := now.Add(promotedPayDuration)
+	if payBy.After(submission.TrainingDate) {
+		payBy = submission.TrainingDate
+	}
+
+	submission.SubmissionState = db.ReceivedSubmissionState
+	submission.PaymentReference = reference
+	submission.PayByDate = payBy
+	submission.PayReminderEmailSent = false
+	submission.ReceivedRequestEmailSent = false
+
+	fmt.Printf("promoting waiting submission id %s, new reference %s\n", submission.GetID(), reference)
+
+	member, err := memberTable.Get(submission.MembershipNumber)
+	if err != nil {
+		return err
+	}
+	if member == nil {
+		// The received request is emailed when the member record arrives
+		return trainTable.Put(submission, submission.GetID())
+	}
+
+	// Use test email address if in test mode
+	if testMode {
+		member.Email = testEmail
+	}
+	return sendReceivedRequest([]*db.MemberRecord{member}, []*db.TrainingSubmission{submission},
+		"A place has become available from the waiting list.")
+}
+
+// newPaymentReference generates a random payment reference with the same layout of letters and digits as those from
+// the training form.
+func newPaymentReference() (string, error) {
+	reference := make([]byte, len(paymentReferenceLayout))
+	for i := range reference {
+		chars := paymentReferenceLetters
+		if paymentReferenceLayout[i] == '0' {
+			chars = paymentReferenceDigits
+		}
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(chars))))
+		if err != nil {
+			return "", fmt.Errorf("failed to generate payment reference: %w", err)
+		}
+		reference[i] = chars[n.Int64()]
+	}
+	return string(reference), nil
+}
+
+// getUsedPaymentReferences gets the payment references of the bookings that can still be paid, or are waiting for a
+// place to pay for.
+func getUsedPaymentReferences() (map[string]bool, error) {
+	used := make(map[string]bool)
+	for _, state := range []string{db.ReceivedSubmissionState, db.PaidSubmissionState, db.WaitingSubmissionState} {
+		submissions, err := trainTable.GetAllOfState(state)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get the payment references in use: %w", err)
+		}
+		for _, submission := range submissions {
+			used[strings.ToUpper(submission.PaymentReference)] = true
+		}
+	}
+	return used, nil
+}
+
+// newUnusedPaymentReference generates a payment reference that no other booking uses, so a payment cannot be matched
+// to another member's booking. The reference is added to those used.
+func newUnusedPaymentReference(used map[string]bool) (string, error) {
+	for range paymentReferenceAttempts {
+		reference, err := newPaymentReference()
+		if err != nil {
+			return "", err
+		}
+		if !used[reference] {
+			used[reference] = true
+			return reference, nil
+		}
+	}
+	return "", fmt.Errorf("no unused payment reference found in %d attempts", paymentReferenceAttempts)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"benjitucker/bathrc-accounts/db"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestPlanWaitingList(t *testing.T) {
+	saved := sessionCapacities
+	defer func() { sessionCapacities = saved }()
+	sessionCapacities = map[string]int{"Widbrook": 2}
+
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	session := now.Add(time.Hour * 48)
+	otherSession := now.Add(time.Hour * 72)
+
+	newSub := func(id string, date time.Time, requested time.Time) *db.TrainingSubmission {
+		sub := &db.TrainingSubmission{
+			Venue:               "Widbrook",
+			TrainingDate:        date,
+			PayByDate:           date.Add(payBeforeSessionDuration),
+			RequestDate:         requested,
+			LinkedSubmissionIds: []string{id},
+		}
+		sub.SetID(id)
+		return sub
+	}
+
+	t.Run("promote into free place in request order", func(t *testing.T) {
+		paid := []*db.TrainingSubmission{newSub("1-0", session, now.Add(-time.Hour*10))}
+		waiting := []*db.TrainingSubmission{
+			newSub("3-0", session, now.Add(-time.Hour*2)),
+			newSub("2-0", session, now.Add(-time.Hour*5)),
+		}
+
+		released, promoted := planWaitingList(now, nil, paid, waiting)
+		if len(released) != 0 {
+			t.Errorf("expected no released submissions, got %d", len(released))
+		}
+		if len(promoted) != 1 || promoted[0].GetID() != "2-0" {
+			t.Fatalf("expected 2-0 to be promoted, got %v", promoted)
+		}
+	})
+
+	t.Run("session still full", func(t *testing.T) {
+		received := []*db.TrainingSubmission{newSub("1-0", session, now.Add(-time.Hour*10))}
+		paid := []*db.TrainingSubmission{newSub("2-0", session, now.Add(-time.Hour*10))}
+		waiting := []*db.TrainingSubmission{newSub("3-0", session, now.Add(-time.Hour*2))}
+
+		released, promoted := planWaitingList(now, received, paid, waiting)
+		if len(released) != 0 || len(promoted) != 0 {
+			t.Errorf("expected nothing to change, got released %d promoted %d", len(released), len(promoted))
+		}
+	})
+
+	t.Run("release overdue unpaid set", func(t *testing.T) {
+		overdue := newSub("1-0", session, now.Add(-time.Hour*100))
+		overdue.PayByDate = now.Add(-unpaidReleaseDuration - time.Hour)
+		overdue.PayReminderEmailSent = true
+		overdue.LinkedSubmissionIds = []string{"1-0", "1-1"}
+		linked := newSub("1-1", otherSession, now.Add(-time.Hour*100))
+		linked.LinkedSubmissionIds = overdue.LinkedSubmissionIds
+
+		notReminded := newSub("2-0", session, now.Add(-time.Hour*100))
+		notReminded.PayByDate = overdue.PayByDate
+
+		waiting := []*db.TrainingSubmission{newSub("3-0", session, now.Add(-time.Hour*2))}
+
+		released, promoted := planWaitingList(now,
+			[]*db.TrainingSubmission{overdue, linked, notReminded}, nil, waiting)
+		if len(released) != 2 {
+			t.Fatalf("expected the overdue set of 2 to be released, got %d", len(released))
+		}
+		for _, r := range released {
+			if r.GetID() == "2-0" {
+				t.Errorf("submission without a pay reminder should not be released")
+			}
+		}
+		if len(promoted) != 1 || promoted[0].GetID() != "3-0" {
+			t.Errorf("expected 3-0 to be promoted, got %v", promoted)
+		}
+	})
+
+	t.Run("no release without waiting members", func(t *testing.T) {
+		overdue := newSub("1-0", session, now.Add(-time.Hour*100))
+		overdue.PayByDate = now.Add(-unpaidReleaseDuration - time.Hour)
+		overdue.PayReminderEmailSent = true
+
+		released, _ := planWaitingList(now, []*db.TrainingSubmission{overdue}, nil, nil)
+		if len(released) != 0 {
+			t.Errorf("expected no released submissions, got %d", len(released))
+		}
+	})
+}
+
+func TestNewPaymentReference(t *testing.T) {
+	ref, err := newPaymentReference()
+	if err != nil {
+		t.Fatalf("newPaymentReference returned error: %v", err)
+	}
+	if !regexp.MustCompile(`^[A-Z]{2}[0-9]{2}$`).MatchString(ref) {
+		t.Errorf("reference %q is not two letters then two digits, like the training form's", ref)
+	}
+}
+
+func TestNewUnusedPaymentReference(t *testing.T) {
+	used := map[string]bool{"ZL44": true}
+	ref, err := newUnusedPaymentReference(used)
+	if err != nil {
+		t.Fatalf("newUnusedPaymentReference returned error: %v", err)
+	}
+	if ref == "ZL44" || !used[ref] {
+		t.Errorf("expected an unused reference to be generated and marked used, got %q", ref)
+	}
+
+	// Every reference is in use
+	for _, a := range paymentReferenceLetters {
+		for _, b := range paymentReferenceLetters {
+			for _, c := range paymentReferenceDigits {
+				for _, d := range paymentReferenceDigits {
+					used[string([]rune{a, b, c, d})] = true
+				}
+			}
+		}
+	}
+	if _, err := newUnusedPaymentReference(used); err == nil {
+		t.Errorf("expected an error when every reference is in use")
+	}
+}
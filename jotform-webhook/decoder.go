@@ -89,6 +89,13 @@ func DecodeBase64Multipart(base64Payload string) (*FormData, error) {
 		}
 		form.RawRequest = rr
 
+	case "Training Cancellation":
+		var rr TrainingCancellationRawRequest
+		if err := json.Unmarshal([]byte(form.RawRequestStr), &rr); err != nil {
+			return nil, err
+		}
+		form.RawRequest = rr
+
 	default:
 		return nil, fmt.Errorf("unsupported formTitle: %s", form.FormTitle)
 	}
@@ -63,9 +63,29 @@ func (f *FormData) DebugString() string {
 			"Training Administration: "+
 				"Send Emails: %s; "+
 				"Uploads: %v; "+
+				"Allocation: %s %s %s; "+
+				"Email Lookup: %s; "+
 				"Submitted: %s",
 			rr.SendEmailsNow,
 			rr.UploadURLs,
+			rr.AllocationAction,
+			rr.AllocateTransaction,
+			rr.AllocateTo,
+			rr.EmailLookup,
+			rr.SubmitDate.Time().Format(time.RFC1123),
+		)
+
+	case TrainingCancellationRawRequest:
+		return header + fmt.Sprintf(
+			"Training Cancellation: "+
+				"PaymentRef: %s; "+
+				"Member: %s; "+
+				"Session: %s %s; "+
+				"Submitted: %s",
+			rr.PaymentReference,
+			rr.MembershipNumber,
+			rr.Venue,
+			rr.SelectSession.StartLocal.Format(time.RFC1123),
 			rr.SubmitDate.Time().Format(time.RFC1123),
 		)
 
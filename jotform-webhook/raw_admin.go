@@ -1,5 +1,10 @@
 package jotform_webhook
 
+import (
+	"encoding/json"
+	"strings"
+)
+
 type TempUpload struct {
 	UploadStatement []string `json:"q4_uploadStatement"`
 }
@@ -17,10 +22,51 @@ type TrainingAdminRawRequest struct {
 	UploadURLs    []string   `json:"uploadStatement"`
 	Path          string     `json:"path"`
 
+	// Manual payment allocation, used instead of an upload
+	AllocationAction    string `json:"-"` // "Attach", "Detach" or "Refund"
+	AllocateTransaction string `json:"-"`
+	AllocateTo          string `json:"-"` // payment reference or submission ID, member number to refund
+
+	// Sent email lookup, used instead of an upload
+	EmailLookup string `json:"-"` // member number or payment reference
+
 	// For test:
 	ExtraCSV *string `json:"extraCsv"`
 }
 
+func (r *TrainingAdminRawRequest) UnmarshalJSON(b []byte) error {
+	type alias TrainingAdminRawRequest
+	aux := (*alias)(r)
+
+	// First unmarshal standard fields
+	if err := json.Unmarshal(b, aux); err != nil {
+		return err
+	}
+
+	// Then find the question fields by the end of their names, the question numbers may change
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(b, &m); err != nil {
+		return err
+	}
+
+	for k, v := range m {
+		if strings.HasSuffix(k, "allocationAction") {
+			_ = json.Unmarshal(v, &r.AllocationAction)
+		}
+		if strings.HasSuffix(k, "transactionId") {
+			_ = json.Unmarshal(v, &r.AllocateTransaction)
+		}
+		if strings.HasSuffix(k, "allocateTo") {
+			_ = json.Unmarshal(v, &r.AllocateTo)
+		}
+		if strings.HasSuffix(k, "emailLookup") {
+			_ = json.Unmarshal(v, &r.EmailLookup)
+		}
+	}
+
+	return nil
+}
+
 func (TrainingAdminRawRequest) FormKind() string {
 	return "Training Administration"
 }
@@ -26,3 +26,54 @@ func TestTrainingAdminRawRequest_Unmarshal(t *testing.T) {
 		t.Errorf("UploadURLs not parsed")
 	}
 }
+
+func TestTrainingAdminRawRequest_UnmarshalAllocation(t *testing.T) {
+	js := `{
+		"submitDate":"1765736311205",
+		"q8_allocationAction":"Attach",
+		"q9_transactionId":"abc123",
+		"q10_allocateTo":"WXYZ"
+	}`
+
+	var rr TrainingAdminRawRequest
+	if err := json.Unmarshal([]byte(js), &rr); err != nil {
+		t.Fatal(err)
+	}
+
+	if rr.AllocationAction != "Attach" || rr.AllocateTransaction != "abc123" || rr.AllocateTo != "WXYZ" {
+		t.Errorf("allocation fields mismatch: %+v", rr)
+	}
+	if len(rr.UploadURLs) != 0 {
+		t.Errorf("unexpected uploads")
+	}
+
+	// The question numbers may change
+	js = `{
+		"q12_allocationAction":"Detach",
+		"q14_transactionId":"def456",
+		"q13_allocateTo":"PQRS"
+	}`
+	rr = TrainingAdminRawRequest{}
+	if err := json.Unmarshal([]byte(js), &rr); err != nil {
+		t.Fatal(err)
+	}
+	if rr.AllocationAction != "Detach" || rr.AllocateTransaction != "def456" || rr.AllocateTo != "PQRS" {
+		t.Errorf("renumbered allocation fields mismatch: %+v", rr)
+	}
+}
+
+func TestTrainingAdminRawRequest_UnmarshalEmailLookup(t *testing.T) {
+	js := `{
+		"submitDate":"1765736311205",
+		"q11_emailLookup":"12345"
+	}`
+
+	var rr TrainingAdminRawRequest
+	if err := json.Unmarshal([]byte(js), &rr); err != nil {
+		t.Fatal(err)
+	}
+
+	if rr.EmailLookup != "12345" {
+		t.Errorf("email lookup mismatch: %+v", rr)
+	}
+}
@@ -0,0 +1,87 @@
+package jotform_webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type TrainingCancellationRawRequest struct {
+	SubmitDate UnixMillis `json:"submitDate"`
+	BuildDate  UnixMillis `json:"buildDate"`
+
+	PaymentReference string  `json:"-"`
+	MembershipNumber string  `json:"-"`
+	Venue            string  `json:"-"`
+	SelectSession    Session `json:"-"`
+}
+
+func (r *TrainingCancellationRawRequest) UnmarshalJSON(b []byte) error {
+	type alias TrainingCancellationRawRequest
+	aux := (*alias)(r)
+
+	// First unmarshal standard fields
+	if err := json.Unmarshal(b, aux); err != nil {
+		return err
+	}
+
+	// Then find the question fields by the end of their names, the question numbers may change
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(b, &m); err != nil {
+		return err
+	}
+
+	for k, v := range m {
+		if strings.HasSuffix(k, "paymentReference") {
+			_ = json.Unmarshal(v, &r.PaymentReference)
+		}
+		if strings.HasSuffix(k, "brcMembership") {
+			_ = json.Unmarshal(v, &r.MembershipNumber)
+		}
+		if strings.HasSuffix(k, "selectedVenue") {
+			_ = json.Unmarshal(v, &r.Venue)
+		}
+	}
+
+	r.PaymentReference = strings.ToUpper(strings.TrimSpace(r.PaymentReference))
+	r.MembershipNumber = strings.TrimSpace(r.MembershipNumber)
+
+	// Use the venue to find the session selection
+	for k, v := range m {
+		if !strings.HasSuffix(k, "select"+r.Venue+"Session") {
+			continue
+		}
+		var sess sessionJSON
+		_ = json.Unmarshal(v, &sess)
+		if sess.Date == "" {
+			continue
+		}
+
+		start, err := ParseSessionDate(sess.Date, sess.Timezone)
+		if err != nil {
+			return fmt.Errorf("cancellation session date parse failed: %w", err)
+		}
+
+		var mins int
+		fmt.Sscan(sess.Duration, &mins)
+		r.SelectSession = Session{
+			StartLocal: start,
+			Duration:   time.Duration(mins) * time.Minute,
+			Timezone:   sess.Timezone,
+		}
+	}
+
+	if r.PaymentReference == "" {
+		return fmt.Errorf("cancellation has no payment reference")
+	}
+	if r.SelectSession.StartLocal.IsZero() {
+		return fmt.Errorf("cancellation has no session selected")
+	}
+
+	return nil
+}
+
+func (TrainingCancellationRawRequest) FormKind() string {
+	return "Training Cancellation"
+}
@@ -0,0 +1,55 @@
+package jotform_webhook
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestTrainingCancellationRawRequest_Unmarshal(t *testing.T) {
+	js := `{
+		"submitDate":"1765736311205",
+		"buildDate":"1765736298125",
+		"q3_paymentReference":" abcd ",
+		"q4_brcMembership":"1234567",
+		"q5_selectedVenue":"Widbrook",
+		"q6_selectWidbrookSession":{
+			"implementation":"new",
+			"date":"2026-01-02 20:00",
+			"duration":"60",
+			"timezone":"Europe/London (GMT)"
+		},
+		"q6_selectWestWiltsSession":{
+			"implementation":"new",
+			"date":"",
+			"duration":"60",
+			"timezone":"Europe/London (GMT)"
+		}
+	}`
+
+	var rr TrainingCancellationRawRequest
+	if err := json.Unmarshal([]byte(js), &rr); err != nil {
+		t.Fatal(err)
+	}
+
+	if rr.PaymentReference != "ABCD" {
+		t.Errorf("PaymentReference = %q", rr.PaymentReference)
+	}
+	if rr.MembershipNumber != "1234567" {
+		t.Errorf("MembershipNumber = %q", rr.MembershipNumber)
+	}
+	if rr.Venue != "Widbrook" {
+		t.Errorf("Venue = %q", rr.Venue)
+	}
+	if _, _, day := rr.SelectSession.StartLocal.Date(); day != 2 || rr.SelectSession.StartLocal.Hour() != 20 {
+		t.Errorf("session parse failed: %v", rr.SelectSession.StartLocal)
+	}
+}
+
+func TestTrainingCancellationRawRequest_Unmarshal_missing_session(t *testing.T) {
+	js := `{"q3_paymentReference":"ABCD","q5_selectedVenue":"Widbrook"}`
+
+	var rr TrainingCancellationRawRequest
+	if err := json.Unmarshal([]byte(js), &rr); err == nil {
+		t.Errorf("expected error for missing session")
+	}
+}
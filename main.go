@@ -12,6 +12,7 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
@@ -24,6 +25,7 @@ import (
 const (
 	trainingRequestForm = "Training"
 	trainingAdminForm   = "Training Administration"
+	trainingCancelForm  = "Training Cancellation"
 )
 
 var (
@@ -31,6 +33,9 @@ var (
 	trainTable               db.TrainingSubmissionTable
 	memberTable              db.MemberTable
 	transactionTable         db.TransactionTable
+	creditTable              db.CreditTable
+	outboxTable              db.OutboxTable
+	sentEmailTable           db.SentEmailTable
 	jotformClient            *jotform.APIClient
 	emailHandler             *email.EmailHandler
 	ssmClient                *ssm.Client
@@ -45,7 +50,7 @@ type EventBridgePayload struct {
 	PeriodType string `json:"period"`
 }
 
-// handler is the entry point for Lambda functions, routing requests to either API Gateway or EventBridge handlers.
+// handler is the entry point for Lambda functions, routing requests to the API Gateway, SNS or EventBridge handlers.
 func handler(raw json.RawMessage) (any, error) {
 
 	// Try API Gateway first
@@ -54,6 +59,13 @@ func handler(raw json.RawMessage) (any, error) {
 		return handleAPIRequest(apiReq)
 	}
 
+	// Try SNS, with SES bounce and complaint notifications
+	var snsEvent events.SNSEvent
+	if err := json.Unmarshal(raw, &snsEvent); err == nil && len(snsEvent.Records) > 0 &&
+		snsEvent.Records[0].EventSource == "aws:sns" {
+		return handleSNSEvent(snsEvent)
+	}
+
 	// Try EventBridge / CloudWatch Event with our custom request payload
 	var eb EventBridgePayload
 	if err := json.Unmarshal(raw, &eb); err == nil && eb.PeriodType != "" {
@@ -73,7 +85,9 @@ func handleEventBridge(payload EventBridgePayload) (any, error) {
 		err := handleHourly(false)
 		if err != nil {
 			fmt.Printf("ERROR: %v\n", err)
-			emailHandler.SendEmail(testEmail, "jotform event bridge: FAIL", err.Error())
+			if sendErr := emailHandler.SendEmail(testEmail, "jotform event bridge: FAIL", err.Error()); sendErr != nil {
+				fmt.Printf("ERROR: %v\n", sendErr)
+			}
 			return nil, err
 		}
 	}
@@ -107,13 +121,18 @@ func handleAPIRequest(req events.LambdaFunctionURLRequest) (events.LambdaFunctio
 		err = handleTrainingRequest(formData.SubmissionID, &request)
 	case trainingAdminForm:
 		err = handleTrainingAdmin(formData, formData.RawRequest.(jotform_webhook.TrainingAdminRawRequest))
+	case trainingCancelForm:
+		request := formData.RawRequest.(jotform_webhook.TrainingCancellationRawRequest)
+		err = handleTrainingCancellation(&request)
 	default:
 		err = fmt.Errorf("unknown form kind: %s", formData.RawRequest.FormKind())
 	}
 
 	if err != nil {
 		fmt.Printf("ERROR: %v\n", err)
-		emailHandler.SendEmail(testEmail, "jotform webhook: FAIL", err.Error())
+		if sendErr := emailHandler.SendEmail(testEmail, "jotform webhook: FAIL", err.Error()); sendErr != nil {
+			fmt.Printf("ERROR: %v\n", sendErr)
+		}
 	}
 
 	resp := events.LambdaFunctionURLResponse{
@@ -166,7 +185,46 @@ func main() {
 	testEmail = getSecret("test-email-address")
 	testEmail2 = getSecret("test-email-address2")
 
-	emailHandler, err = email.NewEmailHandler(ctx, sesClient, email.HandlerParams{
+	if capacities := getSecret("training-session-capacities"); capacities != "" {
+		sessionCapacities, err = parseSessionCapacities(capacities)
+		if err != nil {
+			fmt.Printf("ERROR: %v\n", err)
+			return
+		}
+	}
+
+	if prices := getSecret("training-session-prices"); prices != "" {
+		sessionPrices, err = parseSessionPrices(prices)
+		if err != nil {
+			fmt.Printf("ERROR: %v\n", err)
+			return
+		}
+	}
+
+	if cutOff := getSecret("training-cancellation-cutoff"); cutOff != "" {
+		cancellationCutOff, err = time.ParseDuration(cutOff)
+		if err != nil {
+			fmt.Printf("ERROR: invalid cancellation cut-off %q: %v\n", cutOff, err)
+			return
+		}
+	}
+
+	if window := getSecret("membership-renewal-reminder-window"); window != "" {
+		renewalReminderWindow, err = time.ParseDuration(window)
+		if err != nil {
+			fmt.Printf("ERROR: invalid renewal reminder window %q: %v\n", window, err)
+			return
+		}
+	}
+
+	// Emails are sent with SES unless the EMAIL_TRANSPORT env var selects another transport, see email.NewTransport
+	transport, err := email.NewTransport(os.Getenv("EMAIL_TRANSPORT"), sesClient)
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		return
+	}
+
+	emailHandler, err = email.NewEmailHandler(ctx, transport, email.HandlerParams{
 		AccountNumber: getSecret("bathrc-account-number"),
 		SortCode:      getSecret("bathrc-sort-code"),
 		MonitorEmail:  testEmail,
@@ -198,6 +256,26 @@ func main() {
 		return
 	}
 
+	err = creditTable.Open(ctx, ddb)
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		return
+	}
+
+	err = outboxTable.Open(ctx, ddb)
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		return
+	}
+	emailHandler.UseOutbox(&outboxTable)
+
+	err = sentEmailTable.Open(ctx, ddb)
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		return
+	}
+	emailHandler.UseSentLog(&sentEmailTable)
+
 	jotformClient = jotform.NewJotFormAPIClient(
 		getSecret("bathrc-jotform-apikey"), "json", logLevel == "debug")
 
@@ -10,7 +10,55 @@ import (
 	"time"
 )
 
-// parseMembersCSV parses a CSV byte slice containing member information into a slice of MemberRecord structs.
+// clubProductPrefix starts the column names of the club's membership products in a Sport80 export, e.g.
+// "BATH RIDING CLUB Junior Membership Valid To". Other products in the export, such as the individual membership, are
+// not club memberships.
+const clubProductPrefix = "BATH RIDING CLUB"
+
+// membershipProducts finds the club membership products in the export header, each of which has its own set of
+// status, type and validity columns.
+func membershipProducts(headers []string) []string {
+	var products []string
+	for _, h := range headers {
+		product, found := strings.CutSuffix(strings.Trim(h, `"`), " Valid To")
+		if found && strings.HasPrefix(product, clubProductPrefix) {
+			products = append(products, product)
+		}
+	}
+	return products
+}
+
+// latestMembership returns the membership period that runs latest, which gives the member's summary membership
+// fields.
+func latestMembership(periods []db.MembershipPeriod) *db.MembershipPeriod {
+	var latest *db.MembershipPeriod
+	for i, period := range periods {
+		if period.ValidTo == nil {
+			continue
+		}
+		if latest == nil || period.ValidTo.After(*latest.ValidTo) {
+			latest = &periods[i]
+		}
+	}
+	if latest == nil && len(periods) > 0 {
+		latest = &periods[0]
+	}
+	return latest
+}
+
+func setMemberships(record *db.MemberRecord, periods []db.MembershipPeriod) {
+	record.Memberships = periods
+	if latest := latestMembership(periods); latest != nil {
+		record.ClubMembershipStatus = latest.Status
+		record.MembershipType = latest.Type
+		record.MembershipValidFrom = latest.ValidFrom
+		record.MembershipValidTo = latest.ValidTo
+	}
+}
+
+// parseMembersCSV parses a Sport80 membership export into a slice of MemberRecord structs. Each club membership
+// product in the export becomes a membership period of the member, and a member listed on several rows, one for each
+// product they hold, has the periods of all the rows.
 func parseMembersCSV(data []byte) ([]*db.MemberRecord, error) {
 	reader := csv.NewReader(bytes.NewReader(data))
 	reader.TrimLeadingSpace = true
@@ -26,8 +74,10 @@ func parseMembersCSV(data []byte) ([]*db.MemberRecord, error) {
 	for i, h := range headers {
 		headerIndex[strings.Trim(h, `"`)] = i
 	}
+	products := membershipProducts(headers)
 
 	var records []*db.MemberRecord
+	byNumber := make(map[string]*db.MemberRecord)
 
 	for {
 		row, err := reader.Read()
@@ -45,17 +95,29 @@ func parseMembersCSV(data []byte) ([]*db.MemberRecord, error) {
 			return ""
 		}
 
+		var periods []db.MembershipPeriod
+		for _, product := range products {
+			period := db.MembershipPeriod{
+				Product:   product,
+				Type:      get(product + " Membership Type"),
+				Status:    get(product + " Status"),
+				ValidFrom: parseDate(get(product + " Valid From")),
+				ValidTo:   parseDate(get(product + " Valid To")),
+			}
+			if period.Status == "" && period.ValidFrom == nil && period.ValidTo == nil {
+				// not a product this member holds
+				continue
+			}
+			periods = append(periods, period)
+		}
+
 		record := db.MemberRecord{
-			FirstName:            get("First Name"),
-			LastName:             get("Last Name"),
-			SexAtBirth:           get("Sex at Birth"),
-			Email:                get("Email Address"),
-			MemberNumber:         get("Individual Membership Member No."),
-			ClubMembershipStatus: get("BATH RIDING CLUB Membership Status"),
-			MembershipType:       get("BATH RIDING CLUB Membership Membership Type"),
-			DateOfBirth:          parseDate(get("Date of Birth")),
-			MembershipValidFrom:  parseDate(get("BATH RIDING CLUB Membership Valid From")),
-			MembershipValidTo:    parseDate(get("BATH RIDING CLUB Membership Valid To")),
+			FirstName:    get("First Name"),
+			LastName:     get("Last Name"),
+			SexAtBirth:   get("Sex at Birth"),
+			Email:        get("Email Address"),
+			MemberNumber: get("Individual Membership Member No."),
+			DateOfBirth:  parseDate(get("Date of Birth")),
 		}
 
 		// Check we have all the mandatory fields
@@ -66,6 +128,13 @@ func parseMembersCSV(data []byte) ([]*db.MemberRecord, error) {
 			return nil, fmt.Errorf("missing information in membership record: %s", record.String())
 		}
 
+		if existing := byNumber[record.MemberNumber]; existing != nil {
+			setMemberships(existing, append(existing.Memberships, periods...))
+			continue
+		}
+
+		setMemberships(&record, periods)
+		byNumber[record.MemberNumber] = &record
 		records = append(records, &record)
 	}
 
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"benjitucker/bathrc-accounts/db"
 	"strings"
 	"testing"
+	"time"
 )
 
 var sampleCSV = []byte(`"First Name","Last Name","Date of Birth","Sex at Birth","Email Address","Individual Membership Member No.","BATH RIDING CLUB Membership Status","BATH RIDING CLUB Membership Valid From","BATH RIDING CLUB Membership Valid To","BATH RIDING CLUB Membership Membership Type"
@@ -68,3 +70,65 @@ Alice,Test,1987-01-23,Female,,99703368,Current,invalid date,invalid date,Senior`
 		t.Errorf("expected error")
 	}
 }
+
+func TestParseMembersCSV_MultipleProducts(t *testing.T) {
+	csvData := []byte(`"First Name","Last Name","Email Address","Individual Membership Member No.","Individual Membership Valid To","BATH RIDING CLUB Junior Membership Status","BATH RIDING CLUB Junior Membership Valid From","BATH RIDING CLUB Junior Membership Valid To","BATH RIDING CLUB Junior Membership Membership Type","BATH RIDING CLUB Family Membership Status","BATH RIDING CLUB Family Membership Valid From","BATH RIDING CLUB Family Membership Valid To","BATH RIDING CLUB Family Membership Membership Type"
+Dana,Test,dana@example.com,100,2027-01-01,Current,2025-04-01,2026-03-31,Junior,Current,2026-04-01,2027-03-31,Family
+Eve,Test,eve@example.com,101,2027-01-01,,,,,Current,2025-04-01,2026-03-31,Family
+Dana,Test,dana@example.com,100,2027-01-01,Lapsed,2024-04-01,2025-03-31,Junior,,,,`)
+
+	members, err := parseMembersCSV(csvData)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(members) != 2 {
+		t.Fatalf("expected 2 members, got %d", len(members))
+	}
+
+	dana := members[0]
+	if len(dana.Memberships) != 3 {
+		t.Fatalf("expected 3 membership periods, got %+v", dana.Memberships)
+	}
+	if dana.Memberships[1].Product != "BATH RIDING CLUB Family Membership" || dana.Memberships[1].Type != "Family" {
+		t.Errorf("unexpected period %+v", dana.Memberships[1])
+	}
+	// The summary fields are from the latest period
+	if dana.MembershipType != "Family" || dana.MembershipValidTo.Format(dateLayout) != "2027-03-31" {
+		t.Errorf("unexpected summary %s", dana.String())
+	}
+
+	eve := members[1]
+	if len(eve.Memberships) != 1 || eve.MembershipType != "Family" || eve.ClubMembershipStatus != "Current" {
+		t.Errorf("unexpected member %s %+v", eve.String(), eve.Memberships)
+	}
+
+	on := func(date string) *time.Time {
+		return parseDate(date)
+	}
+	if period := membershipOn(dana, on("2025-12-01")); period == nil || period.Type != "Junior" {
+		t.Errorf("expected the junior membership, got %+v", period)
+	}
+	if period := membershipOn(dana, on("2026-06-01")); period == nil || period.Type != "Family" {
+		t.Errorf("expected the family membership, got %+v", period)
+	}
+	if membershipDateCheck(eve, on("2026-06-01")) {
+		t.Errorf("expected no membership after expiry")
+	}
+	if !membershipDateCheck(eve, on("2026-03-31")) {
+		t.Errorf("expected membership on the expiry date")
+	}
+}
+
+func TestMembershipOn_LegacyRecord(t *testing.T) {
+	member := &db.MemberRecord{
+		MembershipType:      "Senior",
+		MembershipValidFrom: parseDate("2025-04-01"),
+		MembershipValidTo:   parseDate("2026-03-31"),
+	}
+	if period := membershipOn(member, parseDate("2025-05-01")); period == nil || period.Type != "Senior" {
+		t.Errorf("expected the stored membership dates to be used, got %+v", period)
+	}
+	if membershipOn(member, parseDate("2026-05-01")) != nil {
+		t.Errorf("expected no membership after expiry")
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"benjitucker/bathrc-accounts/db"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// memberImport is the difference between an uploaded membership export and the stored member records.
+type memberImport struct {
+	New          []*db.MemberRecord
+	Renewed      []*db.MemberRecord
+	EmailChanged []*db.MemberRecord
+	Lapsed       []*db.MemberRecord
+	Missing      []*db.MemberRecord // current members in the stored records but not in the export
+	previous     map[string]*db.MemberRecord
+}
+
+func formatOptionalDate(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(dateLayout)
+}
+
+// memberChanges lists the changes to the tracked details of a member.
+func memberChanges(stored, record *db.MemberRecord, now time.Time) []db.MemberChange {
+	fields := []struct {
+		name     string
+		old, new string
+	}{
+		{"Email", stored.Email, record.Email},
+		{"MembershipValidFrom", formatOptionalDate(stored.MembershipValidFrom), formatOptionalDate(record.MembershipValidFrom)},
+		{"MembershipValidTo", formatOptionalDate(stored.MembershipValidTo), formatOptionalDate(record.MembershipValidTo)},
+		{"ClubMembershipStatus", stored.ClubMembershipStatus, record.ClubMembershipStatus},
+		{"MembershipType", stored.MembershipType, record.MembershipType},
+	}
+
+	var changes []db.MemberChange
+	for _, field := range fields {
+		if field.old != field.new {
+			changes = append(changes, db.MemberChange{Date: now, Field: field.name, Old: field.old, New: field.new})
+		}
+	}
+	return changes
+}
+
+// diffMembers compares the uploaded member records with the stored ones. The change history of each stored member
+// is carried over to the uploaded record, with any changes found added to it.
+func diffMembers(records, stored []*db.MemberRecord, now time.Time) *memberImport {
+	result := &memberImport{previous: make(map[string]*db.MemberRecord)}
+	for _, member := range stored {
+		result.previous[member.MemberNumber] = member
+	}
+
+	uploaded := make(map[string]bool)
+	for _, record := range records {
+		uploaded[record.MemberNumber] = true
+
+		previous := result.previous[record.MemberNumber]
+		if previous == nil {
+			result.New = append(result.New, record)
+			continue
+		}
+
+		changes := memberChanges(previous, record, now)
+		record.Changes = slices.Concat(previous.Changes, changes)
+		record.RenewalReminderSent = previous.RenewalReminderSent
+		record.UndeliverableEmail = previous.UndeliverableEmail
+		record.UndeliverableReason = previous.UndeliverableReason
+
+		if record.MembershipValidTo != nil &&
+			(previous.MembershipValidTo == nil || record.MembershipValidTo.After(*previous.MembershipValidTo)) {
+			result.Renewed = append(result.Renewed, record)
+		}
+		if !strings.EqualFold(record.Email, previous.Email) {
+			result.EmailChanged = append(result.EmailChanged, record)
+		}
+		if membershipDateCheck(previous, &now) && !membershipDateCheck(record, &now) {
+			result.Lapsed = append(result.Lapsed, record)
+		}
+	}
+
+	for _, member := range stored {
+		if !uploaded[member.MemberNumber] && membershipDateCheck(member, &now) {
+			result.Missing = append(result.Missing, member)
+		}
+	}
+	sort.Slice(result.Missing, func(i, j int) bool {
+		return result.Missing[i].MemberNumber < result.Missing[j].MemberNumber
+	})
+
+	return result
+}
+
+// String describes the differences for the admin email.
+func (m *memberImport) String() string {
+	builder := new(strings.Builder)
+	_, _ = fmt.Fprintf(builder, "%d new, %d renewed, %d changed email, %d lapsed, %d missing from the export\n",
+		len(m.New), len(m.Renewed), len(m.EmailChanged), len(m.Lapsed), len(m.Missing))
+
+	section := func(title string, members []*db.MemberRecord, detail func(member *db.MemberRecord) string) {
+		if len(members) == 0 {
+			return
+		}
+		_, _ = fmt.Fprintf(builder, "\n%s:\n", title)
+		for _, member := range members {
+			_, _ = fmt.Fprintf(builder, "  %s %s %s%s\n", member.MemberNumber, member.FirstName, member.LastName,
+				detail(member))
+		}
+	}
+
+	section("New members", m.New, func(member *db.MemberRecord) string {
+		return ", valid to " + formatOptionalDate(member.MembershipValidTo)
+	})
+	section("Renewed memberships", m.Renewed, func(member *db.MemberRecord) string {
+		return fmt.Sprintf(", valid to %s (was %s)", formatOptionalDate(member.MembershipValidTo),
+			formatOptionalDate(m.previous[member.MemberNumber].MembershipValidTo))
+	})
+	section("Changed emails", m.EmailChanged, func(member *db.MemberRecord) string {
+		return fmt.Sprintf(", %s (was %s)", member.Email, m.previous[member.MemberNumber].Email)
+	})
+	section("Lapsed members", m.Lapsed, func(member *db.MemberRecord) string {
+		return ", valid to " + formatOptionalDate(member.MembershipValidTo)
+	})
+	section("Current members missing from the export", m.Missing, func(member *db.MemberRecord) string {
+		return ", valid to " + formatOptionalDate(member.MembershipValidTo)
+	})
+	return builder.String()
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"benjitucker/bathrc-accounts/db"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiffMembers(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	date := func(s string) *time.Time {
+		d, _ := time.Parse(dateLayout, s)
+		return &d
+	}
+	member := func(number, email, from, to string) *db.MemberRecord {
+		return &db.MemberRecord{
+			MemberNumber:        number,
+			FirstName:           "First" + number,
+			LastName:            "Last" + number,
+			Email:               email,
+			MembershipValidFrom: date(from),
+			MembershipValidTo:   date(to),
+		}
+	}
+
+	earlier := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	renewing := member("M1", "m1@example.com", "2025-04-01", "2026-03-31")
+	renewing.Changes = []db.MemberChange{{Date: earlier, Field: "Email", Old: "old@example.com", New: "m1@example.com"}}
+	renewing.UndeliverableEmail = "m1@example.com"
+
+	stored := []*db.MemberRecord{
+		renewing,
+		member("M2", "m2@example.com", "2025-04-01", "2026-03-31"),
+		member("M3", "m3@example.com", "2025-04-01", "2026-03-31"),
+		member("M4", "m4@example.com", "2025-04-01", "2026-03-31"),
+		member("M5", "m5@example.com", "2024-04-01", "2025-03-31"),
+	}
+	records := []*db.MemberRecord{
+		member("M1", "m1@example.com", "2026-04-01", "2027-03-31"),
+		member("M2", "new2@example.com", "2025-04-01", "2026-03-31"),
+		member("M3", "m3@example.com", "2025-04-01", "2026-02-28"),
+		member("M6", "m6@example.com", "2026-03-01", "2027-02-28"),
+	}
+
+	diff := diffMembers(records, stored, now)
+
+	numbers := func(members []*db.MemberRecord) string {
+		var n []string
+		for _, m := range members {
+			n = append(n, m.MemberNumber)
+		}
+		return strings.Join(n, ",")
+	}
+	if got := numbers(diff.New); got != "M6" {
+		t.Errorf("new = %s", got)
+	}
+	if got := numbers(diff.Renewed); got != "M1" {
+		t.Errorf("renewed = %s", got)
+	}
+	if got := numbers(diff.EmailChanged); got != "M2" {
+		t.Errorf("email changed = %s", got)
+	}
+	if got := numbers(diff.Lapsed); got != "M1,M3" {
+		t.Errorf("lapsed = %s", got)
+	}
+	// M5 had already lapsed so is not missed
+	if got := numbers(diff.Missing); got != "M4" {
+		t.Errorf("missing = %s", got)
+	}
+
+	// History carried over with the new changes added
+	changes := records[0].Changes
+	if len(changes) != 3 || changes[0].Date != earlier {
+		t.Fatalf("unexpected M1 history %+v", changes)
+	}
+	if changes[2].Field != "MembershipValidTo" || changes[2].Old != "2026-03-31" || changes[2].New != "2027-03-31" ||
+		!changes[2].Date.Equal(now) {
+		t.Errorf("unexpected valid to change %+v", changes[2])
+	}
+	if len(records[1].Changes) != 1 || records[1].Changes[0].Field != "Email" {
+		t.Errorf("unexpected M2 history %+v", records[1].Changes)
+	}
+	if records[3].Changes != nil {
+		t.Errorf("expected no history for a new member")
+	}
+
+	// A bounced address stays undeliverable
+	if records[0].EmailDeliverable() {
+		t.Errorf("expected M1 to stay undeliverable")
+	}
+
+	report := diff.String()
+	for _, want := range []string{
+		"1 new, 1 renewed, 1 changed email, 2 lapsed, 1 missing from the export",
+		"M1 FirstM1 LastM1, valid to 2027-03-31 (was 2026-03-31)",
+		"M2 FirstM2 LastM2, new2@example.com (was m2@example.com)",
+		"Current members missing from the export:\n  M4",
+	} {
+		if !strings.Contains(report, want) {
+			t.Errorf("expected %q in %s", want, report)
+		}
+	}
+}
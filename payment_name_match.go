@@ -0,0 +1,119 @@
+package main
+
+import (
+	"benjitucker/bathrc-accounts/db"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/gogf/gf/v2/text/gstr"
+)
+
+const (
+	// nameMatchThreshold is the confidence needed to match a payment by the payer's name when the reference is missing,
+	// e.g. the surname and first initial of a rider in the set.
+	nameMatchThreshold = 85
+	// probableMatchThreshold is the confidence needed to list a payment as a probable match for the treasurer.
+	probableMatchThreshold = 40
+)
+
+// probableMatch is a payment that could belong to a submission set, judged by the payer's name and the amount.
+type probableMatch struct {
+	transaction *db.TransactionRecord
+	set         []*db.TrainingSubmission
+	confidence  int
+}
+
+// nameScore scores how well the payer's name on a transaction matches a member, out of 100. The surname must match,
+// allowing for one mistyped character, and the first name or initial adds to the score. The bank may give the names
+// either way round.
+func nameScore(transaction *db.TransactionRecord, member *db.MemberRecord) int {
+	first := strings.ToUpper(strings.TrimSpace(transaction.FirstName))
+	last := strings.ToUpper(strings.TrimSpace(transaction.LastName))
+	return max(scoreNames(first, last, member), scoreNames(last, first, member))
+}
+
+func scoreNames(first, last string, member *db.MemberRecord) int {
+	memberFirst := strings.ToUpper(strings.TrimSpace(member.FirstName))
+	memberLast := strings.ToUpper(strings.TrimSpace(member.LastName))
+	if last == "" || memberLast == "" {
+		return 0
+	}
+
+	var score int
+	switch {
+	case last == memberLast:
+		score = 60
+	case len(memberLast) > 3 && gstr.Levenshtein(last, memberLast, 1, 1, 1) <= 1:
+		score = 40
+	default:
+		return 0
+	}
+
+	switch {
+	case first == "" || memberFirst == "":
+	case first == memberFirst:
+		score += 40
+	case first[0] == memberFirst[0]:
+		score += 25
+	}
+	return score
+}
+
+// matchByName scores the sets whose outstanding amount is exactly the payment against the payer's name. It returns
+// the set to allocate the payment to when one set is a confident match, otherwise the probable matches.
+func matchByName(transaction *db.TransactionRecord, remaining int64, sets [][]*db.TrainingSubmission,
+	members map[string]*db.MemberRecord) ([]*db.TrainingSubmission, []*probableMatch) {
+
+	var candidates []*probableMatch
+	for _, set := range sets {
+		if setAmountDue(set) != remaining {
+			continue
+		}
+		if dateOnly(transaction.Date).Before(dateOnly(set[0].RequestDate)) {
+			continue
+		}
+		if slices.Contains(set[0].RejectedTransactionIds, transaction.GetID()) {
+			continue
+		}
+
+		confidence := 0
+		for _, submission := range set {
+			member := members[submission.MembershipNumber]
+			if member == nil {
+				continue
+			}
+			confidence = max(confidence, nameScore(transaction, member))
+		}
+		if confidence >= probableMatchThreshold {
+			candidates = append(candidates, &probableMatch{transaction: transaction, set: set, confidence: confidence})
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].confidence > candidates[j].confidence
+	})
+
+	// Only a single confident match is used
+	if len(candidates) > 0 && candidates[0].confidence >= nameMatchThreshold &&
+		(len(candidates) == 1 || candidates[1].confidence < candidates[0].confidence) {
+		return candidates[0].set, nil
+	}
+	return nil, candidates
+}
+
+// getSubmissionMembers looks up the members of the submissions, keyed by member number.
+func getSubmissionMembers(submissions []*db.TrainingSubmission) (map[string]*db.MemberRecord, error) {
+	members := make(map[string]*db.MemberRecord)
+	for _, submission := range submissions {
+		if _, ok := members[submission.MembershipNumber]; ok {
+			continue
+		}
+		member, err := memberTable.Get(submission.MembershipNumber)
+		if err != nil {
+			return nil, err
+		}
+		members[submission.MembershipNumber] = member
+	}
+	return members, nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"benjitucker/bathrc-accounts/db"
+	"testing"
+)
+
+func TestNameScore(t *testing.T) {
+	member := &db.MemberRecord{FirstName: "Jane", LastName: "Smith"}
+	tests := []struct {
+		name        string
+		first, last string
+		want        int
+	}{
+		{"full name", "JANE", "SMITH", 100},
+		{"initial", "J", "SMITH", 85},
+		{"reversed", "SMITH", "J", 85},
+		{"surname only", "MRS", "SMITH", 60},
+		{"mistyped surname", "JANE", "SMYTH", 80},
+		{"different surname", "JANE", "JONES", 0},
+		{"no name", "", "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transaction := &db.TransactionRecord{FirstName: tt.first, LastName: tt.last}
+			if got := nameScore(transaction, member); got != tt.want {
+				t.Errorf("nameScore() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllocatePayments_ByName(t *testing.T) {
+	members := map[string]*db.MemberRecord{
+		"M1": {FirstName: "Jane", LastName: "Smith"},
+		"M2": {FirstName: "John", LastName: "Jones"},
+		"M3": {FirstName: "Jim", LastName: "Jones"},
+	}
+
+	newSub := func(id, ref, memberNumber string) *db.TrainingSubmission {
+		sub := newAllocationTestSubmission(id, ref, 2500, id)
+		sub.MembershipNumber = memberNumber
+		return sub
+	}
+
+	t.Run("confident match", func(t *testing.T) {
+		sub := newSub("1-0", "ABCD", "M1")
+		other := newSub("2-0", "WXYZ", "M2")
+		transaction := newAllocationTestTransaction("T1", "TRAINING", 2500, 2)
+		transaction.FirstName, transaction.LastName = "J", "SMITH"
+
+		matches, probables := allocatePayments([]*db.TransactionRecord{transaction},
+			[]*db.TrainingSubmission{sub, other}, nil, members)
+		if len(matches) != 1 || len(probables) != 0 {
+			t.Fatalf("expected one match and no probables, got %d, %d", len(matches), len(probables))
+		}
+		if sub.PaymentRecordId != "T1" || other.PaymentRecordId != "" {
+			t.Errorf("expected Smith's booking to be paid")
+		}
+	})
+
+	t.Run("amount must be exact", func(t *testing.T) {
+		sub := newSub("1-0", "ABCD", "M1")
+		transaction := newAllocationTestTransaction("T1", "TRAINING", 2000, 2)
+		transaction.FirstName, transaction.LastName = "JANE", "SMITH"
+
+		matches, probables := allocatePayments([]*db.TransactionRecord{transaction},
+			[]*db.TrainingSubmission{sub}, nil, members)
+		if len(matches) != 0 || len(probables) != 0 {
+			t.Errorf("expected no matches, got %d, %d", len(matches), len(probables))
+		}
+	})
+
+	t.Run("ambiguous names are listed", func(t *testing.T) {
+		sub2 := newSub("2-0", "WXYZ", "M2")
+		sub3 := newSub("3-0", "PQRS", "M3")
+		transaction := newAllocationTestTransaction("T1", "TRAINING", 2500, 2)
+		transaction.FirstName, transaction.LastName = "J", "JONES"
+
+		matches, probables := allocatePayments([]*db.TransactionRecord{transaction},
+			[]*db.TrainingSubmission{sub2, sub3}, nil, members)
+		if len(matches) != 0 || len(probables) != 2 {
+			t.Fatalf("expected two probables, got %d, %d", len(matches), len(probables))
+		}
+		if sub2.PaymentRecordId != "" || sub3.PaymentRecordId != "" {
+			t.Errorf("expected nothing to be paid")
+		}
+	})
+
+	t.Run("surname only is listed", func(t *testing.T) {
+		sub := newSub("1-0", "ABCD", "M1")
+		transaction := newAllocationTestTransaction("T1", "TRAINING", 2500, 2)
+		transaction.FirstName, transaction.LastName = "MRS", "SMITH"
+
+		matches, probables := allocatePayments([]*db.TransactionRecord{transaction},
+			[]*db.TrainingSubmission{sub}, nil, members)
+		if len(matches) != 0 || len(probables) != 1 || probables[0].confidence != 60 {
+			t.Errorf("expected one probable at 60%%, got %d, %+v", len(matches), probables)
+		}
+	})
+	t.Run("last week's payment is not used again", func(t *testing.T) {
+		// A weekly rider paid for last week's session, which has now gone in past
+		lastWeek := newSub("1-0", "ABCD", "M1")
+		lastWeek.SubmissionState = db.InPastSubmissionState
+		lastWeek.PaymentRecordId = "T1"
+		lastWeek.Allocations = []db.PaymentAllocation{{TransactionId: "T1", AmountPence: 2500}}
+		thisWeek := newSub("2-0", "WXYZ", "M1")
+		transaction := newAllocationTestTransaction("T1", "TRAINING", 2500, 2)
+		transaction.FirstName, transaction.LastName = "JANE", "SMITH"
+
+		matches, probables := allocatePayments([]*db.TransactionRecord{transaction},
+			[]*db.TrainingSubmission{thisWeek}, []*db.TrainingSubmission{lastWeek}, members)
+		if len(matches) != 0 || len(probables) != 0 {
+			t.Errorf("expected the used payment to be ignored, got %d, %d", len(matches), len(probables))
+		}
+		if thisWeek.PaymentRecordId != "" {
+			t.Errorf("expected this week's booking to be unpaid")
+		}
+	})
+}
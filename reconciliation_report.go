@@ -0,0 +1,208 @@
+package main
+
+import (
+	"benjitucker/bathrc-accounts/db"
+	"benjitucker/bathrc-accounts/email"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// nearMissDistance is the largest calcDistance listed as a near miss for a payment that was not matched, allowing
+// two characters of difference.
+const nearMissDistance = 3
+
+// Reconciliation exception kinds
+const (
+	unmatchedPaymentException = "Unmatched payment"
+	overdueBookingException   = "Unpaid after pay by date"
+	discrepancyException      = "Payment discrepancy"
+	partPaymentException      = "Part payment"
+	nearMissException         = "Near miss"
+	probableMatchException    = "Probable match by name"
+)
+
+// reconciliationException is a line of the reconciliation report, something the treasurer needs to look at.
+type reconciliationException struct {
+	Kind          string
+	Date          time.Time
+	TransactionId string
+	Description   string
+	AmountPence   int64
+	Reference     string
+	SubmissionId  string
+	MemberNumber  string
+	Name          string
+	DuePence      int64
+	Score         string
+	Detail        string
+}
+
+func submissionException(kind string, submission *db.TrainingSubmission,
+	members map[string]*db.MemberRecord) *reconciliationException {
+
+	exception := &reconciliationException{
+		Kind:         kind,
+		Date:         submission.TrainingDate,
+		Reference:    submission.PaymentReference,
+		SubmissionId: submission.GetID(),
+		MemberNumber: submission.MembershipNumber,
+		AmountPence:  submission.AmountPence,
+		DuePence:     submission.AmountDuePence(),
+	}
+	if member := members[submission.MembershipNumber]; member != nil {
+		exception.Name = member.FirstName + " " + member.LastName
+	}
+	return exception
+}
+
+func transactionException(kind string, transaction *db.TransactionRecord) *reconciliationException {
+	return &reconciliationException{
+		Kind:          kind,
+		Date:          transaction.Date,
+		TransactionId: transaction.GetID(),
+		Description:   fullDescription(transaction),
+		AmountPence:   transaction.AmountPence,
+	}
+}
+
+// findReconciliationExceptions lists the payments that are not linked to a booking, with any near misses and
+// probable matches for them, the unpaid bookings past their pay by date, and the discrepancies and part payments.
+func findReconciliationExceptions(transactions []*db.TransactionRecord, received, paid []*db.TrainingSubmission,
+	probables []*probableMatch, members map[string]*db.MemberRecord, now time.Time) []*reconciliationException {
+
+	var exceptions []*reconciliationException
+
+	// The usage stored on the transactions includes their allocations to past and cancelled bookings
+	updateTransactionUsage(transactions, append(paid, received...))
+	sets := openSubmissionSets(received)
+	for _, transaction := range transactions {
+		if transaction.UsedPence > 0 || transaction.Consumed {
+			continue
+		}
+		exceptions = append(exceptions, transactionException(unmatchedPaymentException, transaction))
+
+		for _, set := range sets {
+			if dateOnly(transaction.Date).Before(dateOnly(set[0].RequestDate)) {
+				continue
+			}
+			distance := calcDistance(set[0], transaction)
+			if distance > nearMissDistance {
+				continue
+			}
+			exception := submissionException(nearMissException, set[0], members)
+			exception.TransactionId = transaction.GetID()
+			exception.Description = fullDescription(transaction)
+			exception.AmountPence = transaction.AmountPence
+			exception.DuePence = setAmountDue(set)
+			exception.Score = strconv.Itoa(distance)
+			exception.Detail = "reference distance"
+			exceptions = append(exceptions, exception)
+		}
+	}
+
+	for _, probable := range probables {
+		exception := submissionException(probableMatchException, probable.set[0], members)
+		exception.TransactionId = probable.transaction.GetID()
+		exception.Description = fullDescription(probable.transaction)
+		exception.AmountPence = probable.transaction.AmountPence
+		exception.DuePence = setAmountDue(probable.set)
+		exception.Score = fmt.Sprintf("%d%%", probable.confidence)
+		exception.Detail = "name confidence"
+		exceptions = append(exceptions, exception)
+	}
+
+	for _, submission := range received {
+		if submission.PaymentRecordId != "" {
+			continue
+		}
+		// A part paid booking is reported as a part payment rather than as overdue
+		if submission.SubmissionState == db.ReceivedSubmissionState && !submission.PaymentReceived() &&
+			!submission.PayByDate.IsZero() && submission.PayByDate.Before(now) {
+			exception := submissionException(overdueBookingException, submission, members)
+			exception.Detail = "pay by " + submission.PayByDate.Format(time.RFC1123)
+			exceptions = append(exceptions, exception)
+		}
+		if submission.PaymentReceived() {
+			exception := submissionException(partPaymentException, submission, members)
+			exception.AmountPence = submission.AmountPaidPence()
+			exception.Detail = fmt.Sprintf("%d payments received", len(submission.Allocations))
+			exceptions = append(exceptions, exception)
+		}
+	}
+
+	for _, submission := range append(paid, received...) {
+		if !submission.PaymentDiscrepancy {
+			continue
+		}
+		exception := submissionException(discrepancyException, submission, members)
+		exception.TransactionId = submission.PaymentRecordId
+		exceptions = append(exceptions, exception)
+	}
+
+	return exceptions
+}
+
+// reconciliationReportData counts the exceptions for the report email.
+func reconciliationReportData(exceptions []*reconciliationException, now time.Time) *email.ReconciliationReportData {
+	data := &email.ReconciliationReportData{Date: formatCustomDate(now)}
+	for _, exception := range exceptions {
+		switch exception.Kind {
+		case unmatchedPaymentException:
+			data.UnmatchedPayments++
+		case overdueBookingException:
+			data.OverdueBookings++
+		case discrepancyException, partPaymentException:
+			data.Discrepancies++
+		case nearMissException, probableMatchException:
+			data.NearMisses++
+		}
+	}
+	return data
+}
+
+// reconciliationCSV writes the exceptions as a CSV file for the treasurer to work through.
+func reconciliationCSV(exceptions []*reconciliationException) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	_ = w.Write([]string{"Kind", "Date", "Transaction ID", "Description", "Amount", "Reference", "Submission ID",
+		"Member", "Name", "Due", "Score", "Detail"})
+
+	for _, exception := range exceptions {
+		_ = w.Write([]string{
+			exception.Kind,
+			exception.Date.Format("02 Jan 2006"),
+			exception.TransactionId,
+			exception.Description,
+			formatPounds(exception.AmountPence),
+			exception.Reference,
+			exception.SubmissionId,
+			exception.MemberNumber,
+			exception.Name,
+			formatPounds(exception.DuePence),
+			exception.Score,
+			exception.Detail,
+		})
+	}
+
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// sendReconciliationReport emails the treasurer the reconciliation exceptions after a bank statement upload.
+func sendReconciliationReport(transactions []*db.TransactionRecord, received, paid []*db.TrainingSubmission,
+	probables []*probableMatch, members map[string]*db.MemberRecord) error {
+
+	now := time.Now()
+	exceptions := findReconciliationExceptions(transactions, received, paid, probables, members, now)
+
+	csvBytes, err := reconciliationCSV(exceptions)
+	if err != nil {
+		return err
+	}
+
+	return emailHandler.SendReconciliationReport(testEmail, reconciliationReportData(exceptions, now),
+		fmt.Sprintf("reconciliation-%s.csv", now.Format("2006-01-02")), csvBytes)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"benjitucker/bathrc-accounts/db"
+	"bytes"
+	"encoding/csv"
+	"testing"
+	"time"
+)
+
+func TestFindReconciliationExceptions(t *testing.T) {
+	now := time.Date(2026, 4, 10, 12, 0, 0, 0, time.UTC)
+	members := map[string]*db.MemberRecord{
+		"M1": {FirstName: "Jane", LastName: "Smith"},
+	}
+
+	paidSub := newAllocationTestSubmission("1-0", "ABCD", 2500, "1-0")
+	paidSub.SubmissionState = db.PaidSubmissionState
+	paidSub.PaymentRecordId = "T1"
+	paidSub.PaymentDiscrepancy = true
+
+	overdue := newAllocationTestSubmission("2-0", "WXYZ", 2500, "2-0")
+	overdue.MembershipNumber = "M1"
+	overdue.PayByDate = now.Add(-time.Hour)
+
+	partPaid := newAllocationTestSubmission("3-0", "PQRS", 3000, "3-0")
+	partPaid.PayByDate = now.Add(time.Hour)
+	partPaid.Allocations = []db.PaymentAllocation{{TransactionId: "T2", AmountPence: 1000}}
+
+	matched := newAllocationTestTransaction("T1", "ABCD", 3000, 2)
+	part := newAllocationTestTransaction("T2", "PQRS", 1000, 3)
+	unmatched := newAllocationTestTransaction("T3", "WXYY MORE", 2500, 4)
+
+	exceptions := findReconciliationExceptions([]*db.TransactionRecord{matched, part, unmatched},
+		[]*db.TrainingSubmission{overdue, partPaid}, []*db.TrainingSubmission{paidSub}, nil, members, now)
+
+	kinds := make(map[string][]*reconciliationException)
+	for _, exception := range exceptions {
+		kinds[exception.Kind] = append(kinds[exception.Kind], exception)
+	}
+
+	if got := kinds[unmatchedPaymentException]; len(got) != 1 || got[0].TransactionId != "T3" {
+		t.Errorf("expected T3 unmatched, got %+v", got)
+	}
+	if got := kinds[nearMissException]; len(got) != 1 || got[0].Reference != "WXYZ" || got[0].Score != "2" {
+		t.Errorf("expected near miss to WXYZ at distance 2, got %+v", got)
+	}
+	if got := kinds[overdueBookingException]; len(got) != 1 || got[0].SubmissionId != "2-0" ||
+		got[0].Name != "Jane Smith" {
+		t.Errorf("expected overdue 2-0 for Jane Smith, got %+v", got)
+	}
+	if got := kinds[partPaymentException]; len(got) != 1 || got[0].DuePence != 2000 || got[0].AmountPence != 1000 {
+		t.Errorf("expected part payment with £20 due, got %+v", got)
+	}
+	if got := kinds[discrepancyException]; len(got) != 1 || got[0].TransactionId != "T1" {
+		t.Errorf("expected discrepancy on T1, got %+v", got)
+	}
+
+	data := reconciliationReportData(exceptions, now)
+	if data.UnmatchedPayments != 1 || data.OverdueBookings != 1 || data.Discrepancies != 2 || data.NearMisses != 1 {
+		t.Errorf("unexpected report counts %+v", data)
+	}
+
+	csvBytes, err := reconciliationCSV(exceptions)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rows, err := csv.NewReader(bytes.NewReader(csvBytes)).ReadAll()
+	if err != nil {
+		t.Fatalf("failed to read CSV: %v", err)
+	}
+	if len(rows) != len(exceptions)+1 || rows[0][0] != "Kind" {
+		t.Errorf("expected header and %d rows, got %v", len(exceptions), rows)
+	}
+}
+
+func TestFindReconciliationExceptions_SettledPayments(t *testing.T) {
+	now := time.Date(2026, 4, 10, 12, 0, 0, 0, time.UTC)
+
+	// Paid for a session now in the past, and a part payment towards a cancelled booking, neither of which are
+	// passed in as received or paid
+	pastSession := newAllocationTestTransaction("T1", "ABCD", 2500, 2)
+	pastSession.UsedPence = 2500
+	pastSession.Consumed = true
+	cancelled := newAllocationTestTransaction("T2", "PQRS", 1000, 3)
+	cancelled.UsedPence = 1000
+
+	exceptions := findReconciliationExceptions([]*db.TransactionRecord{pastSession, cancelled},
+		nil, nil, nil, nil, now)
+	if len(exceptions) != 0 {
+		t.Errorf("expected no exceptions for used payments, got %+v", exceptions)
+	}
+}
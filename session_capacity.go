@@ -0,0 +1,101 @@
+package main
+
+import (
+	"benjitucker/bathrc-accounts/db"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+)
+
+const (
+	defaultSessionCapacity = 6
+	sessionTimeLayout      = "15:04"
+)
+
+// sessionCapacities holds the maximum number of riders per session. Keys are either a venue name, which applies to
+// every session at that venue, or "<venue> <15:04>" to override a single session start time at that venue.
+// The defaults can be replaced by the "training-session-capacities" parameter as a JSON object.
+var sessionCapacities = map[string]int{
+	"West Wilts": defaultSessionCapacity,
+	"Widbrook":   defaultSessionCapacity,
+}
+
+// parseSessionCapacities parses the JSON object of session capacities held in the parameter store.
+func parseSessionCapacities(value string) (map[string]int, error) {
+	capacities := make(map[string]int)
+	if err := json.Unmarshal([]byte(value), &capacities); err != nil {
+		return nil, fmt.Errorf("invalid session capacities %q: %w", value, err)
+	}
+	for key, capacity := range capacities {
+		if capacity < 0 {
+			return nil, fmt.Errorf("invalid session capacity for %s: %d", key, capacity)
+		}
+	}
+	return capacities, nil
+}
+
+// sessionCapacity returns the maximum number of riders for the session at the venue starting at trainingDate.
+func sessionCapacity(venue string, trainingDate time.Time) int {
+	if capacity, ok := sessionCapacities[venue+" "+trainingDate.Format(sessionTimeLayout)]; ok {
+		return capacity
+	}
+	if capacity, ok := sessionCapacities[venue]; ok {
+		return capacity
+	}
+	return defaultSessionCapacity
+}
+
+func isSameSession(a, b *db.TrainingSubmission) bool {
+	return a.Venue == b.Venue && a.TrainingDate.Equal(b.TrainingDate)
+}
+
+// countSessionBookings counts the submissions that hold a place in the same session as the given submission,
+// ignoring any with an ID in excludeIds.
+func countSessionBookings(submission *db.TrainingSubmission, booked []*db.TrainingSubmission, excludeIds []string) int {
+	count := 0
+	for _, other := range booked {
+		if !isSameSession(submission, other) {
+			continue
+		}
+		if !slices.Contains(excludeIds, other.GetID()) {
+			count++
+		}
+	}
+	return count
+}
+
+// getBookingsAt retrieves the RECEIVED and PAID submissions, which each hold a place, for sessions at any venue
+// starting at trainingDate.
+func getBookingsAt(trainingDate time.Time) ([]*db.TrainingSubmission, error) {
+	var result []*db.TrainingSubmission
+	for _, state := range []string{db.ReceivedSubmissionState, db.PaidSubmissionState} {
+		// Allow a little either side of the start time, exact matches are filtered below
+		subs, err := trainTable.GetAllOfStateBetween(state,
+			trainingDate.Add(-time.Minute), trainingDate.Add(time.Minute))
+		if err != nil {
+			return nil, err
+		}
+		for _, sub := range subs {
+			if sub.TrainingDate.Equal(trainingDate) {
+				result = append(result, sub)
+			}
+		}
+	}
+	return result, nil
+}
+
+// findDuplicateBooking returns a submission by the same member for a session at the same time, ignoring any with an
+// ID in excludeIds, or nil if there is none.
+func findDuplicateBooking(submission *db.TrainingSubmission, booked []*db.TrainingSubmission,
+	excludeIds []string) *db.TrainingSubmission {
+	for _, other := range booked {
+		if other.MembershipNumber != submission.MembershipNumber ||
+			!other.TrainingDate.Equal(submission.TrainingDate) ||
+			slices.Contains(excludeIds, other.GetID()) {
+			continue
+		}
+		return other
+	}
+	return nil
+}
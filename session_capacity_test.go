@@ -0,0 +1,91 @@
+package main
+
+import (
+	"benjitucker/bathrc-accounts/db"
+	"testing"
+	"time"
+)
+
+func TestSessionCapacity(t *testing.T) {
+	saved := sessionCapacities
+	defer func() { sessionCapacities = saved }()
+
+	capacities, err := parseSessionCapacities(`{"Widbrook": 4, "Widbrook 19:00": 2}`)
+	if err != nil {
+		t.Fatalf("parseSessionCapacities returned error: %v", err)
+	}
+	sessionCapacities = capacities
+
+	evening := time.Date(2026, 5, 1, 19, 0, 0, 0, time.UTC)
+	morning := time.Date(2026, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	if got := sessionCapacity("Widbrook", evening); got != 2 {
+		t.Errorf("evening capacity = %d, want 2", got)
+	}
+	if got := sessionCapacity("Widbrook", morning); got != 4 {
+		t.Errorf("morning capacity = %d, want 4", got)
+	}
+	if got := sessionCapacity("Elsewhere", morning); got != defaultSessionCapacity {
+		t.Errorf("unknown venue capacity = %d, want %d", got, defaultSessionCapacity)
+	}
+
+	if _, err := parseSessionCapacities(`{"Widbrook": -1}`); err == nil {
+		t.Errorf("expected error for negative capacity")
+	}
+	if _, err := parseSessionCapacities(`not json`); err == nil {
+		t.Errorf("expected error for invalid json")
+	}
+}
+
+func TestCountSessionBookings(t *testing.T) {
+	session := time.Date(2026, 5, 1, 19, 0, 0, 0, time.UTC)
+
+	newSub := func(id, venue string, date time.Time) *db.TrainingSubmission {
+		sub := &db.TrainingSubmission{Venue: venue, TrainingDate: date}
+		sub.SetID(id)
+		return sub
+	}
+
+	request := newSub("100-0", "Widbrook", session)
+	booked := []*db.TrainingSubmission{
+		newSub("1-0", "Widbrook", session),
+		newSub("2-0", "Widbrook", session),
+		newSub("3-0", "West Wilts", session),
+		newSub("4-0", "Widbrook", session.Add(time.Hour)),
+		newSub("100-0", "Widbrook", session),
+	}
+
+	if got := countSessionBookings(request, booked, nil); got != 3 {
+		t.Errorf("countSessionBookings = %d, want 3", got)
+	}
+	if got := countSessionBookings(request, booked, []string{"100-0"}); got != 2 {
+		t.Errorf("countSessionBookings excluding own id = %d, want 2", got)
+	}
+}
+
+func TestFindDuplicateBooking(t *testing.T) {
+	session := time.Date(2026, 5, 1, 19, 0, 0, 0, time.UTC)
+
+	newSub := func(id, member, venue string, date time.Time) *db.TrainingSubmission {
+		sub := &db.TrainingSubmission{MembershipNumber: member, Venue: venue, TrainingDate: date}
+		sub.SetID(id)
+		return sub
+	}
+
+	request := newSub("100-0", "M1", "Widbrook", session)
+	booked := []*db.TrainingSubmission{
+		newSub("1-0", "M2", "Widbrook", session),
+		newSub("2-0", "M1", "Widbrook", session.Add(time.Hour)),
+		newSub("100-0", "M1", "Widbrook", session),
+	}
+
+	if got := findDuplicateBooking(request, booked, []string{"100-0"}); got != nil {
+		t.Errorf("expected no duplicate, got %s", got.GetID())
+	}
+
+	booked = append(booked, newSub("3-0", "M1", "West Wilts", session))
+	got := findDuplicateBooking(request, booked, []string{"100-0"})
+	if got == nil || got.GetID() != "3-0" {
+		t.Fatalf("expected duplicate 3-0, got %v", got)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"benjitucker/bathrc-accounts/db"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Price categories of a training session
+const (
+	memberPrice    = "member"
+	nonMemberPrice = "non-member"
+	juniorPrice    = "junior"
+)
+
+// sessionPrices holds the price in pence of a training session for each price category. Keys are either a category,
+// which applies at every venue, or "<venue> <category>" to override the price at a venue. A junior member is charged
+// the member price if no junior price is set. There are no prices by default, so nothing is checked until they are
+// set by the "training-session-prices" parameter as a JSON object.
+var sessionPrices = map[string]int64{}
+
+// parseSessionPrices parses the JSON object of session prices held in the parameter store.
+func parseSessionPrices(value string) (map[string]int64, error) {
+	prices := make(map[string]int64)
+	if err := json.Unmarshal([]byte(value), &prices); err != nil {
+		return nil, fmt.Errorf("invalid session prices %q: %w", value, err)
+	}
+	for key, price := range prices {
+		if price < 0 {
+			return nil, fmt.Errorf("invalid session price for %s: %d", key, price)
+		}
+	}
+	return prices, nil
+}
+
+// priceCategory is the price category for a submission. Whether the rider is a member is taken from the request,
+// as a request made as a member without a current membership is followed up separately. A member whose membership
+// on the training date, or failing that their latest membership, is a junior one pays the junior price.
+func priceCategory(member *db.MemberRecord, submission *db.TrainingSubmission) string {
+	if !submission.RequestCurrMem {
+		return nonMemberPrice
+	}
+
+	membershipType := member.MembershipType
+	if period := membershipOn(member, &submission.TrainingDate); period != nil {
+		membershipType = period.Type
+	}
+	if strings.Contains(strings.ToLower(membershipType), juniorPrice) {
+		return juniorPrice
+	}
+	return memberPrice
+}
+
+// sessionPrice returns the price of a session at the venue for the price category, and false if there is none set.
+func sessionPrice(venue, category string) (int64, bool) {
+	for _, key := range []string{venue + " " + category, category} {
+		if price, ok := sessionPrices[key]; ok {
+			return price, true
+		}
+	}
+	if category == juniorPrice {
+		return sessionPrice(venue, memberPrice)
+	}
+	return 0, false
+}
+
+// checkSessionPrice compares the amount of a submission with the price of the session for the member. When it
+// differs, the submission is flagged with the price. The amount the member is asked to pay is left as requested, so a
+// wrong price set in the parameter store cannot change what members pay. It returns whether the amount differs.
+func checkSessionPrice(member *db.MemberRecord, submission *db.TrainingSubmission) bool {
+	category := priceCategory(member, submission)
+	price, ok := sessionPrice(submission.Venue, category)
+	if !ok || price == submission.AmountPence {
+		return false
+	}
+
+	fmt.Printf("Amount %s for submission id %s does not match the %s price %s at %s\n",
+		formatAmount(submission.AmountPence), submission.GetID(), category, formatAmount(price), submission.Venue)
+
+	submission.PriceMismatch = true
+	submission.PricePence = price
+	return true
+}
+
+// checkAndReportSessionPrice checks the amount of a submission against the price of the session, storing the
+// submission and emailing the mismatch when it differs. The member is told in the received request email.
+func checkAndReportSessionPrice(member *db.MemberRecord, submission *db.TrainingSubmission) error {
+	if !checkSessionPrice(member, submission) {
+		return nil
+	}
+
+	err := trainTable.Put(submission, submission.GetID())
+	if err != nil {
+		return err
+	}
+
+	return emailHandler.SendEmail(testEmail, "Training: PRICE MISMATCH",
+		fmt.Sprintf("amount for %s %s (%s) on %s at %s is %s, the %s price is %s",
+			member.FirstName, member.LastName, member.MemberNumber, formatCustomDate(submission.TrainingDate),
+			submission.Venue, formatAmount(submission.AmountPence), priceCategory(member, submission),
+			formatAmount(submission.PricePence)))
+}
+
+// priceMismatchText describes any submissions whose amount differs from the session price, for inclusion in the
+// received request email.
+func priceMismatchText(members []*db.MemberRecord, submissions []*db.TrainingSubmission) string {
+	var texts []string
+	for i, submission := range submissions {
+		if !submission.PriceMismatch || i >= len(members) || members[i] == nil {
+			continue
+		}
+		texts = append(texts, fmt.Sprintf("Please note that the amount of %s for %s %s on %s differs from %s, the "+
+			"%s price at %s. Please pay the amount requested, the club will be in touch about the difference.",
+			formatAmount(submission.AmountPence), members[i].FirstName, members[i].LastName,
+			formatCustomDate(submission.TrainingDate), formatAmount(submission.PricePence),
+			priceCategory(members[i], submission), submission.Venue))
+	}
+	return strings.Join(texts, " ")
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"benjitucker/bathrc-accounts/db"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckSessionPrice(t *testing.T) {
+	saved := sessionPrices
+	defer func() { sessionPrices = saved }()
+
+	prices, err := parseSessionPrices(`{"member": 2500, "non-member": 3500, "junior": 2000, "West Wilts member": 3000}`)
+	if err != nil {
+		t.Fatalf("parseSessionPrices returned error: %v", err)
+	}
+	sessionPrices = prices
+
+	trainingDate := time.Date(2026, 5, 1, 19, 0, 0, 0, time.UTC)
+	senior := &db.MemberRecord{
+		FirstName: "Jane", LastName: "Doe", MemberNumber: "M1",
+		Memberships: []db.MembershipPeriod{{Type: "Senior", ValidFrom: parseDate("2026-04-01"), ValidTo: parseDate("2027-03-31")}},
+	}
+	junior := &db.MemberRecord{
+		FirstName: "Ann", LastName: "Doe", MemberNumber: "M2",
+		Memberships: []db.MembershipPeriod{{Type: "Junior", ValidFrom: parseDate("2026-04-01"), ValidTo: parseDate("2027-03-31")}},
+	}
+
+	tests := []struct {
+		name      string
+		member    *db.MemberRecord
+		venue     string
+		requested bool
+		amount    int64
+		price     int64
+	}{
+		{"member price", senior, "Widbrook", true, 2500, 2500},
+		{"venue member price", senior, "West Wilts", true, 2500, 3000},
+		{"junior price", junior, "Widbrook", true, 2500, 2000},
+		{"non-member price", senior, "Widbrook", false, 2500, 3500},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			submission := &db.TrainingSubmission{
+				Venue: tt.venue, TrainingDate: trainingDate, RequestCurrMem: tt.requested, AmountPence: tt.amount,
+			}
+			submission.SetID("S1")
+			mismatch := checkSessionPrice(tt.member, submission)
+			if mismatch != (tt.amount != tt.price) || submission.PriceMismatch != mismatch {
+				t.Errorf("mismatch = %v, flagged = %v", mismatch, submission.PriceMismatch)
+			}
+			// The member still pays the amount requested
+			if submission.AmountPence != tt.amount {
+				t.Errorf("amount = %d, want %d", submission.AmountPence, tt.amount)
+			}
+			if mismatch && submission.PricePence != tt.price {
+				t.Errorf("price = %d, want %d", submission.PricePence, tt.price)
+			}
+		})
+	}
+
+	submission := &db.TrainingSubmission{Venue: "Widbrook", TrainingDate: trainingDate, RequestCurrMem: true,
+		AmountPence: 2500}
+	submission.SetID("S2")
+	checkSessionPrice(junior, submission)
+	text := priceMismatchText([]*db.MemberRecord{junior}, []*db.TrainingSubmission{submission})
+	if !strings.Contains(text, "amount of £25.00 for Ann Doe on") || !strings.Contains(text, "£20.00, the junior price") {
+		t.Errorf("unexpected text %q", text)
+	}
+
+	// Without a price nothing is checked
+	sessionPrices = map[string]int64{}
+	submission = &db.TrainingSubmission{Venue: "Widbrook", RequestCurrMem: true, AmountPence: 1}
+	if checkSessionPrice(senior, submission) || submission.AmountPence != 1 {
+		t.Errorf("expected no mismatch without prices")
+	}
+
+	if _, err := parseSessionPrices(`{"member": -1}`); err == nil {
+		t.Errorf("expected error for negative price")
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"benjitucker/bathrc-accounts/db"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// camtDocument is the part of an ISO 20022 camt.053 bank to customer statement that is needed for the transactions.
+// Element names are matched without their namespace, so any version of the message can be read.
+type camtDocument struct {
+	Statements []camtStatement `xml:"BkToCstmrStmt>Stmt"`
+}
+
+type camtStatement struct {
+	Balances []camtBalance `xml:"Bal"`
+	Entries  []camtEntry   `xml:"Ntry"`
+}
+
+type camtBalance struct {
+	Code      string     `xml:"Tp>CdOrPrtry>Cd"`
+	Amount    camtAmount `xml:"Amt"`
+	CreditDeb string     `xml:"CdtDbtInd"`
+}
+
+type camtAmount struct {
+	Value string `xml:",chardata"`
+}
+
+type camtDate struct {
+	Date     string `xml:"Dt"`
+	DateTime string `xml:"DtTm"`
+}
+
+type camtEntry struct {
+	Amount         camtAmount       `xml:"Amt"`
+	CreditDebit    string           `xml:"CdtDbtInd"`
+	BookingDate    camtDate         `xml:"BookgDt"`
+	ValueDate      camtDate         `xml:"ValDt"`
+	SubFamily      string           `xml:"BkTxCd>Domn>Fmly>SubFmlyCd"`
+	AdditionalInfo string           `xml:"AddtlNtryInf"`
+	Details        []camtTxnDetails `xml:"NtryDtls>TxDtls"`
+}
+
+type camtTxnDetails struct {
+	Amount           camtAmount `xml:"Amt"`
+	DebtorName       string     `xml:"RltdPties>Dbtr>Nm"`
+	DebtorPartyName  string     `xml:"RltdPties>Dbtr>Pty>Nm"`
+	CreditorName     string     `xml:"RltdPties>Cdtr>Nm"`
+	CreditorPtyName  string     `xml:"RltdPties>Cdtr>Pty>Nm"`
+	Unstructured     []string   `xml:"RmtInf>Ustrd"`
+	StructuredRefs   []string   `xml:"RmtInf>Strd>CdtrRefInf>Ref"`
+	AdditionalTxInfo string     `xml:"AddtlTxInf"`
+}
+
+// isCamt053 reports whether an uploaded statement is an ISO 20022 camt.053 XML statement.
+func isCamt053(data []byte) bool {
+	return bytes.Contains(data, []byte("BkToCstmrStmt"))
+}
+
+func (d camtDate) time() (time.Time, error) {
+	s := d.Date
+	if s == "" && len(d.DateTime) >= 10 {
+		s = d.DateTime[:10]
+	}
+	return time.Parse("2006-01-02", s)
+}
+
+// camtSubFamilyKinds maps bank transaction sub family codes onto the OFX style kinds used by statementType.
+var camtSubFamilyKinds = map[string]string{
+	"CHRG": "FEE",
+	"FEES": "FEE",
+	"COMM": "FEE",
+	"INTR": "FEE",
+	"PMDD": "DIRECTDEBIT",
+	"UPDD": "DIRECTDEBIT",
+	"BBDD": "DIRECTDEBIT",
+	"ESDD": "DIRECTDEBIT",
+	"POSD": "POS",
+	"CDPT": "POS",
+}
+
+// splitName splits an account holder's name into a first and last name, which nameScore compares either way round.
+func splitName(name string) (first, last string) {
+	fields := strings.Fields(name)
+	switch len(fields) {
+	case 0:
+		return "", ""
+	case 1:
+		return fields[0], ""
+	default:
+		return fields[0], fields[len(fields)-1]
+	}
+}
+
+// remittanceInformation returns the payment reference given by the payer, preferring the structured creditor
+// reference to the free text.
+func remittanceInformation(entry camtEntry, details camtTxnDetails) string {
+	for _, ref := range details.StructuredRefs {
+		if strings.TrimSpace(ref) != "" {
+			return strings.TrimSpace(ref)
+		}
+	}
+	if text := strings.TrimSpace(strings.Join(details.Unstructured, " ")); text != "" {
+		return text
+	}
+	if details.AdditionalTxInfo != "" {
+		return strings.TrimSpace(details.AdditionalTxInfo)
+	}
+	return strings.TrimSpace(entry.AdditionalInfo)
+}
+
+func camtSignedAmount(amount camtAmount, creditDebit string) (int64, error) {
+	pence, err := parsePence(strings.TrimSpace(amount.Value))
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q: %w", amount.Value, err)
+	}
+	if strings.EqualFold(creditDebit, "DBIT") {
+		pence = -pence
+	}
+	return pence, nil
+}
+
+// parseTransactionsCamt053 parses the entries of a camt.053 statement into transactions, one for each transaction
+// detail of a batched entry. The payment reference is kept as the description and the payer's (or, for payments out,
+// the payee's) name is used for the first and last names. Balances run on from the opening balance, or back from the
+// closing balance.
+func parseTransactionsCamt053(data []byte) ([]*db.TransactionRecord, error) {
+	var doc camtDocument
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid camt.053 statement: %w", err)
+	}
+
+	var transactions []*db.TransactionRecord
+	for _, statement := range doc.Statements {
+		var stmtTransactions []*db.TransactionRecord
+		for _, entry := range statement.Entries {
+			entryTransactions, err := camtTransactions(entry)
+			if err != nil {
+				return nil, err
+			}
+			stmtTransactions = append(stmtTransactions, entryTransactions...)
+		}
+
+		err := camtBalances(statement.Balances, stmtTransactions)
+		if err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, stmtTransactions...)
+	}
+
+	if transactions == nil {
+		return nil, errors.New("no entries found in camt.053 statement")
+	}
+	return transactions, nil
+}
+
+func camtTransactions(entry camtEntry) ([]*db.TransactionRecord, error) {
+	date, err := entry.BookingDate.time()
+	if err != nil {
+		date, err = entry.ValueDate.time()
+		if err != nil {
+			return nil, fmt.Errorf("invalid camt.053 entry date: %w", err)
+		}
+	}
+
+	details := entry.Details
+	if len(details) == 0 {
+		details = []camtTxnDetails{{}}
+	}
+
+	entryAmount, err := camtSignedAmount(entry.Amount, entry.CreditDebit)
+	if err != nil {
+		return nil, err
+	}
+
+	var transactions []*db.TransactionRecord
+	var batchTotal int64
+	for _, detail := range details {
+		amount := entryAmount
+		if len(details) > 1 {
+			// A batched entry must give the amount of each transaction in its details, as the entry's amount is the
+			// total of them all
+			if detail.Amount.Value == "" {
+				return nil, fmt.Errorf("camt.053 batched entry of %s on %s has a transaction without an amount",
+					formatAmount(entryAmount), date.Format("02 Jan 2006"))
+			}
+			amount, err = camtSignedAmount(detail.Amount, entry.CreditDebit)
+			if err != nil {
+				return nil, err
+			}
+			batchTotal += amount
+		}
+
+		name := detail.DebtorName + detail.DebtorPartyName
+		if amount < 0 {
+			name = detail.CreditorName + detail.CreditorPtyName
+		}
+		first, last := splitName(name)
+
+		transactions = append(transactions, &db.TransactionRecord{
+			Date:        date,
+			ExpireAt:    date.Add(transactionRecordTTL).Unix(),
+			Type:        statementType(camtSubFamilyKinds[strings.ToUpper(entry.SubFamily)], amount),
+			Description: remittanceInformation(entry, detail),
+			FirstName:   first,
+			LastName:    last,
+			AmountPence: amount,
+		})
+	}
+
+	if len(details) > 1 && batchTotal != entryAmount {
+		return nil, fmt.Errorf("camt.053 batched entry of %s on %s has transactions totalling %s",
+			formatAmount(entryAmount), date.Format("02 Jan 2006"), formatAmount(batchTotal))
+	}
+	return transactions, nil
+}
+
+// camtBalances sets the balance after each transaction from the statement's opening or closing booked balance.
+func camtBalances(balances []camtBalance, transactions []*db.TransactionRecord) error {
+	for _, code := range []string{"OPBD", "PRCD"} {
+		for _, balance := range balances {
+			if balance.Code != code {
+				continue
+			}
+			running, err := camtSignedAmount(balance.Amount, balance.CreditDeb)
+			if err != nil {
+				return err
+			}
+			for _, transaction := range transactions {
+				running += transaction.AmountPence
+				transaction.BalancePence = running
+			}
+			return nil
+		}
+	}
+
+	for _, balance := range balances {
+		if balance.Code != "CLBD" {
+			continue
+		}
+		running, err := camtSignedAmount(balance.Amount, balance.CreditDeb)
+		if err != nil {
+			return err
+		}
+		for i := len(transactions) - 1; i >= 0; i-- {
+			transactions[i].BalancePence = running
+			running -= transactions[i].AmountPence
+		}
+		return nil
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"testing"
+)
+
+const camtStatementXML = `<?xml version="1.0" encoding="UTF-8"?>
+<Document xmlns="urn:iso:std:iso:20022:tech:xsd:camt.053.001.02">
+  <BkToCstmrStmt>
+    <GrpHdr><MsgId>1</MsgId></GrpHdr>
+    <Stmt>
+      <Bal>
+        <Tp><CdOrPrtry><Cd>OPBD</Cd></CdOrPrtry></Tp>
+        <Amt Ccy="GBP">100.00</Amt>
+        <CdtDbtInd>CRDT</CdtDbtInd>
+        <Dt><Dt>2026-01-01</Dt></Dt>
+      </Bal>
+      <Ntry>
+        <Amt Ccy="GBP">25.00</Amt>
+        <CdtDbtInd>CRDT</CdtDbtInd>
+        <BookgDt><Dt>2026-01-05</Dt></BookgDt>
+        <BkTxCd><Domn><Cd>PMNT</Cd><Fmly><Cd>RCDT</Cd><SubFmlyCd>ESCT</SubFmlyCd></Fmly></Domn></BkTxCd>
+        <NtryDtls><TxDtls>
+          <RltdPties><Dbtr><Nm>MRS JANE SMITH</Nm></Dbtr></RltdPties>
+          <RmtInf><Ustrd>ABCD</Ustrd></RmtInf>
+        </TxDtls></NtryDtls>
+      </Ntry>
+      <Ntry>
+        <Amt Ccy="GBP">55.00</Amt>
+        <CdtDbtInd>CRDT</CdtDbtInd>
+        <BookgDt><DtTm>2026-01-06T10:15:00</DtTm></BookgDt>
+        <NtryDtls>
+          <TxDtls>
+            <Amt Ccy="GBP">30.00</Amt>
+            <RltdPties><Dbtr><Pty><Nm>John Jones</Nm></Pty></Dbtr></RltdPties>
+            <RmtInf><Strd><CdtrRefInf><Ref>WXYZ</Ref></CdtrRefInf></Strd></RmtInf>
+          </TxDtls>
+          <TxDtls>
+            <Amt Ccy="GBP">25.00</Amt>
+            <RltdPties><Dbtr><Nm>Ann Brown</Nm></Dbtr></RltdPties>
+            <RmtInf><Ustrd>TRAINING</Ustrd><Ustrd>PQRS</Ustrd></RmtInf>
+          </TxDtls>
+        </NtryDtls>
+      </Ntry>
+      <Ntry>
+        <Amt Ccy="GBP">2.50</Amt>
+        <CdtDbtInd>DBIT</CdtDbtInd>
+        <BookgDt><Dt>2026-01-07</Dt></BookgDt>
+        <BkTxCd><Domn><Cd>ACMT</Cd><Fmly><Cd>MDOP</Cd><SubFmlyCd>CHRG</SubFmlyCd></Fmly></Domn></BkTxCd>
+        <AddtlNtryInf>ACCOUNT FEE</AddtlNtryInf>
+      </Ntry>
+    </Stmt>
+  </BkToCstmrStmt>
+</Document>`
+
+func TestParseTransactionsCamt053(t *testing.T) {
+	data := []byte(camtStatementXML)
+	if !isCamt053(data) {
+		t.Fatalf("expected camt.053 to be detected")
+	}
+
+	transactions, err := parseBankStatement(data)
+	if err != nil {
+		t.Fatalf("parseBankStatement returned error: %v", err)
+	}
+	if len(transactions) != 4 {
+		t.Fatalf("expected 4 transactions, got %d", len(transactions))
+	}
+
+	tests := []struct {
+		date, txnType, description, first, last string
+		amount, balance                         int64
+	}{
+		{"05 Jan 2026", "CR", "ABCD", "MRS", "SMITH", 2500, 12500},
+		{"06 Jan 2026", "CR", "WXYZ", "John", "Jones", 3000, 15500},
+		{"06 Jan 2026", "CR", "TRAINING PQRS", "Ann", "Brown", 2500, 18000},
+		{"07 Jan 2026", "CHG", "ACCOUNT FEE", "", "", -250, 17750},
+	}
+	for i, tt := range tests {
+		got := transactions[i]
+		if !got.Date.Equal(mustParseDate(tt.date)) || got.Type != tt.txnType || got.Description != tt.description ||
+			got.FirstName != tt.first || got.LastName != tt.last || got.AmountPence != tt.amount ||
+			got.BalancePence != tt.balance {
+			t.Errorf("transaction %d = %s, want %+v", i, got.String(), tt)
+		}
+	}
+
+	// The reference is matched exactly rather than searched for in the payer's name
+	if distance := calcDistance(newAllocationTestSubmission("1-0", "WXYZ", 3000), transactions[1]); distance != 0 {
+		t.Errorf("expected exact reference match, got distance %d", distance)
+	}
+}
+
+func TestParseTransactionsCamt053_ClosingBalance(t *testing.T) {
+	data := []byte(`<Document><BkToCstmrStmt><Stmt>
+<Bal><Tp><CdOrPrtry><Cd>CLBD</Cd></CdOrPrtry></Tp><Amt>50.00</Amt><CdtDbtInd>CRDT</CdtDbtInd></Bal>
+<Ntry><Amt>20.00</Amt><CdtDbtInd>CRDT</CdtDbtInd><BookgDt><Dt>2026-01-05</Dt></BookgDt></Ntry>
+<Ntry><Amt>10.00</Amt><CdtDbtInd>DBIT</CdtDbtInd><BookgDt><Dt>2026-01-06</Dt></BookgDt></Ntry>
+</Stmt></BkToCstmrStmt></Document>`)
+
+	transactions, err := parseTransactionsCamt053(data)
+	if err != nil {
+		t.Fatalf("parseTransactionsCamt053 returned error: %v", err)
+	}
+	if len(transactions) != 2 || transactions[0].BalancePence != 6000 || transactions[1].BalancePence != 5000 {
+		t.Errorf("unexpected balances %v", transactions)
+	}
+	if transactions[1].Type != "BP" {
+		t.Errorf("expected a payment out to be BP, got %s", transactions[1].Type)
+	}
+}
+
+func TestParseTransactionsCamt053_BatchAmounts(t *testing.T) {
+	batch := func(details string) []byte {
+		return []byte(`<Document><BkToCstmrStmt><Stmt>
+<Ntry><Amt>55.00</Amt><CdtDbtInd>CRDT</CdtDbtInd><BookgDt><Dt>2026-01-06</Dt></BookgDt>
+<NtryDtls>` + details + `</NtryDtls></Ntry>
+</Stmt></BkToCstmrStmt></Document>`)
+	}
+
+	// The batch total is never used for a transaction without its own amount
+	_, err := parseTransactionsCamt053(batch(`<TxDtls><Amt>30.00</Amt></TxDtls><TxDtls></TxDtls>`))
+	if err == nil {
+		t.Errorf("expected an error for a batched transaction without an amount")
+	}
+
+	_, err = parseTransactionsCamt053(batch(`<TxDtls><Amt>30.00</Amt></TxDtls><TxDtls><Amt>20.00</Amt></TxDtls>`))
+	if err == nil {
+		t.Errorf("expected an error for batched transactions that do not add up to the entry")
+	}
+}
@@ -66,13 +66,225 @@ func splitDescription(s string) (first, last, rest string) {
 	}
 }
 
-// parseTransactionsCSV parses a CSV byte slice containing transaction records into a slice of TransactionRecord structs.
+// newTransactionRecord builds a transaction from a bank statement line, splitting the payer's name from the
+// description.
+func newTransactionRecord(date time.Time, txnType, description string, amount, balance int64) *db.TransactionRecord {
+	first, last, remainder := splitDescription(description)
+
+	return &db.TransactionRecord{
+		Date:         date,
+		ExpireAt:     date.Add(transactionRecordTTL).Unix(),
+		Type:         txnType,
+		Description:  remainder,
+		FirstName:    first,
+		LastName:     last,
+		AmountPence:  amount,
+		BalancePence: balance,
+	}
+}
+
+// parseBankStatement parses an uploaded bank statement in whichever format the bank's download page offered: camt.053,
+// OFX, QIF or the bank's CSV layout.
+func parseBankStatement(data []byte) ([]*db.TransactionRecord, error) {
+	switch {
+	case isCamt053(data):
+		return parseTransactionsCamt053(data)
+	case isOFX(data):
+		return parseTransactionsOFX(data)
+	case isQIF(data):
+		return parseTransactionsQIF(data)
+	default:
+		return parseTransactionsCSV(data)
+	}
+}
+
+// bankCSVProfile describes the columns of a bank's CSV statement download. Each column lists the header names it may
+// have, compared ignoring case. The amount is either a signed amount column or separate debit and credit columns.
+type bankCSVProfile struct {
+	Name        string
+	Date        []string
+	DateLayouts []string
+	Type        []string          // optional
+	TypeCodes   map[string]string // the bank's type codes mapped onto ours, empty to type by the amount's sign
+	Description []string
+	Amount      []string
+	Debit       []string
+	Credit      []string
+	Balance     []string // optional
+}
+
+// bankCSVProfiles are tried in order against the header row of an uploaded CSV statement.
+var bankCSVProfiles = []*bankCSVProfile{
+	{
+		Name:        "Lloyds",
+		Date:        []string{"Transaction Date"},
+		DateLayouts: []string{"02/01/2006", "02 Jan 2006"},
+		Type:        []string{"Transaction Type"},
+		TypeCodes:   map[string]string{"FPI": "CR", "BGC": "CR", "FPO": "BP", "DEB": "VIS", "PAY": "BP"},
+		Description: []string{"Transaction Description"},
+		Debit:       []string{"Debit Amount"},
+		Credit:      []string{"Credit Amount"},
+		Balance:     []string{"Balance"},
+	},
+	{
+		Name:        "Barclays",
+		Date:        []string{"Date"},
+		DateLayouts: []string{"02/01/2006", "02 Jan 2006"},
+		Type:        []string{"Subcategory"},
+		// Transfers are typed by the sign of the amount
+		TypeCodes: map[string]string{"FUNDS TRANSFER": "", "COUNTER CREDIT": "CR", "DIRECT DEBIT": "DD",
+			"DEBIT": "VIS", "BILL PAYMENT": "BP"},
+		Description: []string{"Memo"},
+		Amount:      []string{"Amount"},
+	},
+	{
+		Name:        "NatWest",
+		Date:        []string{"Date"},
+		DateLayouts: []string{"02 Jan 2006", "02/01/2006"},
+		Type:        []string{"Type"},
+		Description: []string{"Description"},
+		Amount:      []string{"Value", "Amount"},
+		Balance:     []string{"Balance"},
+	},
+}
+
+// bankCSVColumns is a profile resolved against a header row, -1 for a column that is not present.
+type bankCSVColumns struct {
+	profile                                           *bankCSVProfile
+	date, txnType, description, amount, debit, credit int
+	balance                                           int
+}
+
+func normaliseHeader(h string) string {
+	return strings.ToLower(strings.TrimSpace(strings.Trim(strings.TrimPrefix(h, "\ufeff"), `"`)))
+}
+
+func findColumn(headerIndex map[string]int, names []string) int {
+	for _, name := range names {
+		if idx, ok := headerIndex[normaliseHeader(name)]; ok {
+			return idx
+		}
+	}
+	return -1
+}
+
+// resolve finds the profile's columns in the header row, reporting whether all the required columns are present.
+func (p *bankCSVProfile) resolve(headerIndex map[string]int) (*bankCSVColumns, bool) {
+	c := &bankCSVColumns{
+		profile:     p,
+		date:        findColumn(headerIndex, p.Date),
+		txnType:     findColumn(headerIndex, p.Type),
+		description: findColumn(headerIndex, p.Description),
+		amount:      findColumn(headerIndex, p.Amount),
+		debit:       findColumn(headerIndex, p.Debit),
+		credit:      findColumn(headerIndex, p.Credit),
+		balance:     findColumn(headerIndex, p.Balance),
+	}
+	if c.date < 0 || c.description < 0 {
+		return nil, false
+	}
+	if c.amount < 0 && (c.debit < 0 || c.credit < 0) {
+		return nil, false
+	}
+	return c, true
+}
+
+// selectCSVProfile picks the statement profile whose columns are all in the header row. Columns are never read by
+// position, so a renamed column is an error rather than a silent misreading.
+func selectCSVProfile(header []string) (*bankCSVColumns, error) {
+	headerIndex := make(map[string]int)
+	for i, h := range header {
+		headerIndex[normaliseHeader(h)] = i
+	}
+
+	for _, profile := range bankCSVProfiles {
+		if columns, ok := profile.resolve(headerIndex); ok {
+			return columns, nil
+		}
+	}
+	return nil, fmt.Errorf("unrecognised bank statement columns %q", header)
+}
+
+func (c *bankCSVColumns) get(record []string, idx int) string {
+	if idx < 0 || idx >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[idx])
+}
+
+// parseAmount reads an amount that may include a currency sign or thousands separators. An empty amount is zero.
+func parseAmount(s string) (int64, error) {
+	s = strings.NewReplacer("£", "", ",", "", " ", "").Replace(s)
+	if s == "" {
+		return 0, nil
+	}
+	return parsePence(strings.TrimPrefix(s, "+"))
+}
+
+func (c *bankCSVColumns) transaction(record []string) (*db.TransactionRecord, error) {
+	dateStr := c.get(record, c.date)
+	var date time.Time
+	var err error
+	for _, layout := range c.profile.DateLayouts {
+		date, err = time.Parse(layout, dateStr)
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid date %q: %w", dateStr, err)
+	}
+
+	var amount int64
+	if c.amount >= 0 {
+		amount, err = parseAmount(c.get(record, c.amount))
+		if err != nil {
+			return nil, fmt.Errorf("invalid amount %q: %w", c.get(record, c.amount), err)
+		}
+	} else {
+		debit, err := parseAmount(c.get(record, c.debit))
+		if err != nil {
+			return nil, fmt.Errorf("invalid debit amount %q: %w", c.get(record, c.debit), err)
+		}
+		credit, err := parseAmount(c.get(record, c.credit))
+		if err != nil {
+			return nil, fmt.Errorf("invalid credit amount %q: %w", c.get(record, c.credit), err)
+		}
+		amount = credit - max(debit, -debit)
+	}
+
+	var balance int64
+	if c.balance >= 0 {
+		balance, err = parseAmount(c.get(record, c.balance))
+		if err != nil {
+			return nil, fmt.Errorf("invalid balance %q: %w", c.get(record, c.balance), err)
+		}
+	}
+
+	txnType := c.get(record, c.txnType)
+	if code, ok := c.profile.TypeCodes[strings.ToUpper(txnType)]; ok {
+		txnType = code
+	}
+	if txnType == "" {
+		txnType = statementType("", amount)
+	}
+
+	return newTransactionRecord(date, txnType, c.get(record, c.description), amount, balance), nil
+}
+
+// parseTransactionsCSV parses a bank CSV statement into transactions, finding the columns from the header row.
 func parseTransactionsCSV(csvData []byte) ([]*db.TransactionRecord, error) {
 	r := csv.NewReader(bytes.NewReader(csvData))
 	r.TrimLeadingSpace = true
+	r.FieldsPerRecord = -1 // allow variable columns
+
+	header, err := r.Read()
+	if err != nil {
+		return nil, err
+	}
 
-	// Read header
-	if _, err := r.Read(); err != nil {
+	columns, err := selectCSVProfile(header)
+	if err != nil {
 		return nil, err
 	}
 
@@ -87,33 +299,11 @@ func parseTransactionsCSV(csvData []byte) ([]*db.TransactionRecord, error) {
 			return nil, err
 		}
 
-		date, err := time.Parse("02 Jan 2006", record[0])
+		transaction, err := columns.transaction(record)
 		if err != nil {
-			return nil, fmt.Errorf("invalid date %q: %w", record[0], err)
-		}
-
-		amount, err := parsePence(record[3])
-		if err != nil {
-			return nil, fmt.Errorf("invalid amount %q: %w", record[3], err)
-		}
-
-		balance, err := parsePence(record[4])
-		if err != nil {
-			return nil, fmt.Errorf("invalid balance %q: %w", record[4], err)
+			return nil, err
 		}
-
-		first, last, remainder := splitDescription(record[2])
-
-		transactions = append(transactions, &db.TransactionRecord{
-			Date:         date,
-			ExpireAt:     date.Add(transactionRecordTTL).Unix(),
-			Type:         record[1],
-			Description:  remainder,
-			FirstName:    first,
-			LastName:     last,
-			AmountPence:  amount,
-			BalancePence: balance,
-		})
+		transactions = append(transactions, transaction)
 	}
 
 	return transactions, nil
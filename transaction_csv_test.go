@@ -32,7 +32,7 @@ func TestParsePence(t *testing.T) {
 }
 
 func TestParseCSV(t *testing.T) {
-	csvData := []byte(`TrainingDate,Type,Description,Amount,Balance
+	csvData := []byte(`Date,Type,Description,Amount,Balance
 22 Dec 2025,CR,FOG BA BOB FOG,20.00,13141.19
 22 Dec 2025,CR,Spot Payments,-10.01,13121.19`)
 
@@ -80,3 +80,80 @@ func mustParseDate(s string) time.Time {
 func mustParseDateUnix(s string) int64 {
 	return mustParseDate(s).Unix()
 }
+
+func TestParseCSV_Profiles(t *testing.T) {
+	tests := []struct {
+		name    string
+		csvData string
+		want    []*db.TransactionRecord
+	}{
+		{
+			name: "NatWest with extra columns in a different order",
+			csvData: `Date,Type,Description,Value,Balance,Account Name,Account Number
+22 Dec 2025,CR,FOG BA BOB FOG,20.00,"13,141.19",CLUB,123`,
+			want: []*db.TransactionRecord{
+				{Type: "CR", FirstName: "FOG", LastName: "BA", Description: "BOB FOG", AmountPence: 2000,
+					BalancePence: 1314119},
+			},
+		},
+		{
+			name: "Lloyds debit and credit columns",
+			csvData: `Transaction Date,Transaction Type,Sort Code,Account Number,Transaction Description,Debit Amount,Credit Amount,Balance
+22/12/2025,FPI,'30-00-00,12345678,FOG BA ABCD,,20.00,131.19
+22/12/2025,DEB,'30-00-00,12345678,SPOT PAYMENTS,10.01,,121.18`,
+			want: []*db.TransactionRecord{
+				{Type: "CR", FirstName: "FOG", LastName: "BA", Description: "ABCD", AmountPence: 2000,
+					BalancePence: 13119},
+				{Type: "VIS", FirstName: "SPOT", LastName: "PAYMENTS", AmountPence: -1001, BalancePence: 12118},
+			},
+		},
+		{
+			name: "Barclays without balance, header case changed",
+			csvData: `Number,DATE,Account,Amount,Subcategory,Memo
+,22/12/2025,20-00-00 12345678,20.00,Funds Transfer,FOG BA ABCD
+,22/12/2025,20-00-00 12345678,-10.01,Direct Debit,SPOT PAYMENTS`,
+			want: []*db.TransactionRecord{
+				{Type: "CR", FirstName: "FOG", LastName: "BA", Description: "ABCD", AmountPence: 2000},
+				{Type: "DD", FirstName: "SPOT", LastName: "PAYMENTS", AmountPence: -1001},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transactions, err := parseTransactionsCSV([]byte(tt.csvData))
+			if err != nil {
+				t.Fatalf("parseTransactionsCSV returned error: %v", err)
+			}
+			for _, want := range tt.want {
+				want.Date = mustParseDate("22 Dec 2025")
+				want.ExpireAt = mustParseDateUnix("22 Dec 2027")
+			}
+			if !reflect.DeepEqual(transactions, tt.want) {
+				t.Errorf("parseTransactionsCSV() = %v; want %v", transactions, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCSV_UnknownColumns(t *testing.T) {
+	_, err := parseTransactionsCSV([]byte(`When,What,How Much
+22 Dec 2025,FOG BA,20.00`))
+	if err == nil {
+		t.Errorf("expected an error for unrecognised columns")
+	}
+
+	// Renamed columns are not silently read by position
+	_, err = parseTransactionsCSV([]byte(`Posted,Kind,Details,Value,Balance,Account
+22 Dec 2025,CR,FOG BA,20.00,131.19,CLUB`))
+	if err == nil {
+		t.Errorf("expected an error for unrecognised columns")
+	}
+
+	// Not even when there are five of them, as in the original layout
+	_, err = parseTransactionsCSV([]byte(`Posted,Kind,Details,Value,Balance
+22 Dec 2025,CR,FOG BA,20.00,131.19`))
+	if err == nil {
+		t.Errorf("expected an error for renamed five column header")
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"benjitucker/bathrc-accounts/db"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// transactionImport is the outcome of comparing an uploaded statement with the transactions already imported.
+type transactionImport struct {
+	New         []*db.TransactionRecord
+	Skipped     []*db.TransactionRecord // already imported
+	Conflicting []*db.TransactionRecord // same identity as an imported transaction but a different balance
+	Unsure      []*db.TransactionRecord // skipped, but may be a further identical payment on the statement's first day
+	conflicts   map[*db.TransactionRecord]*db.TransactionRecord
+}
+
+// classifyTransactions assigns IDs to the uploaded transactions and sorts them into new ones, ones already imported
+// by an earlier upload of an overlapping statement, and ones that conflict with an imported transaction. Transactions
+// imported before IDs were assigned by AssignIds are recognised by their original Hash.
+func classifyTransactions(records []*db.TransactionRecord,
+	getTransaction func(id string) (*db.TransactionRecord, error)) (*transactionImport, error) {
+
+	db.AssignIds(records)
+	unsure, err := continueOccurrences(records, getTransaction)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &transactionImport{Unsure: unsure, conflicts: make(map[*db.TransactionRecord]*db.TransactionRecord)}
+	for _, record := range records {
+		existing, err := getTransaction(record.GetID())
+		if err != nil {
+			return nil, err
+		}
+		if existing == nil {
+			existing, err = getTransaction(record.Hash())
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		switch {
+		case existing == nil:
+			result.New = append(result.New, record)
+		case existing.BalancePence == record.BalancePence || existing.BalancePence == 0 || record.BalancePence == 0:
+			result.Skipped = append(result.Skipped, record)
+		default:
+			result.Conflicting = append(result.Conflicting, record)
+			result.conflicts[record] = existing
+		}
+	}
+	return result, nil
+}
+
+// continueOccurrences renumbers identical transactions on the same day against those already imported, as they may
+// have arrived in separate statements. An uploaded transaction takes the number of the imported one with its balance.
+// Otherwise, when the statement covers the whole day, the imported ones are in it and it takes the next of their
+// numbers. When the statement starts on the day, partway through it, a transaction whose balance differs from those
+// imported continues the numbering after them. Without balances to tell, it is taken to be one already imported and
+// returned as unsure.
+func continueOccurrences(records []*db.TransactionRecord,
+	getTransaction func(id string) (*db.TransactionRecord, error)) ([]*db.TransactionRecord, error) {
+
+	from, _ := dateRange(records)
+	groups := make(map[string][]*db.TransactionRecord)
+	var keys []string
+	for _, record := range db.Chronological(records) {
+		probe := *record
+		probe.Occurrence = 0
+		key := probe.Identity()
+		if groups[key] == nil {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], record)
+	}
+
+	var unsure []*db.TransactionRecord
+	for _, key := range keys {
+		group := groups[key]
+
+		// The imported transactions identical to these, by their number
+		var stored []*db.TransactionRecord
+		for {
+			probe := *group[0]
+			probe.Occurrence = len(stored)
+			existing, err := getTransaction(probe.Identity())
+			if err != nil {
+				return nil, err
+			}
+			if existing == nil {
+				break
+			}
+			stored = append(stored, existing)
+		}
+		if len(stored) == 0 {
+			continue
+		}
+
+		wholeDay := dateOnly(from).Before(dateOnly(group[0].Date))
+		used := make(map[int]bool)
+		next := len(stored)
+		for _, record := range group {
+			occurrence, unused := -1, -1
+			for n, existing := range stored {
+				if used[n] {
+					continue
+				}
+				if unused < 0 {
+					unused = n
+				}
+				if record.BalancePence != 0 && existing.BalancePence == record.BalancePence {
+					occurrence = n
+					break
+				}
+			}
+
+			switch {
+			case occurrence >= 0:
+			case unused >= 0 && wholeDay:
+				occurrence = unused
+			case unused >= 0 && (record.BalancePence == 0 || stored[unused].BalancePence == 0):
+				occurrence = unused
+				unsure = append(unsure, record)
+			default:
+				occurrence = next
+				next++
+			}
+			used[occurrence] = true
+			record.Occurrence = occurrence
+			record.SetID(record.Identity())
+		}
+	}
+	return unsure, nil
+}
+
+func dateRange(records []*db.TransactionRecord) (from, to time.Time) {
+	for i, record := range records {
+		if i == 0 || record.Date.Before(from) {
+			from = record.Date
+		}
+		if i == 0 || record.Date.After(to) {
+			to = record.Date
+		}
+	}
+	return from, to
+}
+
+// String describes the import for the admin confirmation email.
+func (i *transactionImport) String() string {
+	builder := new(strings.Builder)
+	total := len(i.New) + len(i.Skipped) + len(i.Conflicting)
+	_, _ = fmt.Fprintf(builder, "Uploaded %d transactions: %d new, %d already imported, %d conflicting\n",
+		total, len(i.New), len(i.Skipped), len(i.Conflicting))
+
+	if len(i.Skipped) > 0 {
+		from, to := dateRange(i.Skipped)
+		_, _ = fmt.Fprintf(builder, "\nThe statement overlaps transactions already imported from %s to %s, "+
+			"these have been skipped.\n", formatCustomDate(from), formatCustomDate(to))
+	}
+
+	if len(i.Unsure) > 0 {
+		_, _ = fmt.Fprintf(builder, "\nThese transactions on the first day of the statement are identical to ones "+
+			"already imported and have been skipped. Without balances it cannot be told whether they are further "+
+			"payments, check the statement:\n")
+		for _, record := range i.Unsure {
+			_, _ = fmt.Fprintf(builder, "  %s\n", record.String())
+		}
+	}
+
+	if len(i.Conflicting) > 0 {
+		_, _ = fmt.Fprintf(builder, "\nThese transactions match imported transactions but the balance differs, "+
+			"they have not been imported. Check the statement:\n")
+		for _, record := range i.Conflicting {
+			_, _ = fmt.Fprintf(builder, "  %s\n    imported as %s\n", record.String(), i.conflicts[record].String())
+		}
+	}
+
+	if len(i.New) > 0 {
+		_, _ = fmt.Fprintf(builder, "\nNew transactions:\n")
+		for _, record := range i.New {
+			_, _ = fmt.Fprintf(builder, "  %s\n", record.String())
+		}
+	}
+	return builder.String()
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"benjitucker/bathrc-accounts/db"
+	"strings"
+	"testing"
+)
+
+func TestClassifyTransactions(t *testing.T) {
+	newTxn := func(day int, description string, amount, balance int64) *db.TransactionRecord {
+		return &db.TransactionRecord{
+			Date:         mustParseDate("22 Dec 2025").AddDate(0, 0, day),
+			Type:         "CR",
+			FirstName:    "J",
+			LastName:     "SMITH",
+			Description:  description,
+			AmountPence:  amount,
+			BalancePence: balance,
+		}
+	}
+
+	// Two identical payments on the same day
+	first := []*db.TransactionRecord{
+		newTxn(0, "ABCD", 2500, 10000),
+		newTxn(0, "ABCD", 2500, 12500),
+		newTxn(1, "WXYZ", 3000, 15500),
+	}
+
+	stored := make(map[string]*db.TransactionRecord)
+	get := func(id string) (*db.TransactionRecord, error) {
+		return stored[id], nil
+	}
+
+	imported, err := classifyTransactions(first, get)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(imported.New) != 3 || len(imported.Skipped) != 0 || len(imported.Conflicting) != 0 {
+		t.Fatalf("expected 3 new, got %s", imported)
+	}
+	if first[0].GetID() == first[1].GetID() {
+		t.Fatalf("expected identical same day payments to have different IDs")
+	}
+	for _, record := range imported.New {
+		stored[record.GetID()] = record
+	}
+
+	// Downloaded again newest first, overlapping the first upload, with a legacy transaction and a conflict
+	legacy := newTxn(2, "PQRS", 2000, 17500)
+	stored[legacy.Hash()] = legacy
+	second := []*db.TransactionRecord{
+		newTxn(3, "LMNO", 1000, 18500),
+		newTxn(2, "PQRS", 2000, 17500),
+		newTxn(1, "WXYZ", 3000, 99999),
+		newTxn(0, "ABCD", 2500, 12500),
+		newTxn(0, "ABCD", 2500, 10000),
+	}
+
+	imported, err = classifyTransactions(second, get)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(imported.New) != 1 || imported.New[0].Description != "LMNO" {
+		t.Errorf("expected LMNO to be new, got %v", imported.New)
+	}
+	if len(imported.Skipped) != 3 {
+		t.Errorf("expected 3 skipped, got %v", imported.Skipped)
+	}
+	if len(imported.Conflicting) != 1 || imported.Conflicting[0].Description != "WXYZ" {
+		t.Errorf("expected WXYZ to conflict, got %v", imported.Conflicting)
+	}
+	if second[4].GetID() != first[0].GetID() || second[3].GetID() != first[1].GetID() {
+		t.Errorf("expected same day payments to keep their IDs when listed newest first")
+	}
+
+	report := imported.String()
+	for _, want := range []string{"5 transactions: 1 new, 3 already imported, 1 conflicting",
+		"overlaps transactions already imported", "imported as", "LMNO"} {
+		if !strings.Contains(report, want) {
+			t.Errorf("expected %q in %s", want, report)
+		}
+	}
+}
+
+func TestClassifyTransactions_Reordered(t *testing.T) {
+	newTxn := func(description string, amount, balance int64) *db.TransactionRecord {
+		return &db.TransactionRecord{Date: mustParseDate("22 Dec 2025"), Type: "CR", FirstName: "J",
+			LastName: "SMITH", Description: description, AmountPence: amount, BalancePence: balance}
+	}
+
+	// Two identical payments on a day, with a refund between them
+	first := []*db.TransactionRecord{
+		newTxn("ABCD", 2500, 10000),
+		newTxn("REFUND", -500, 9500),
+		newTxn("ABCD", 2500, 12000),
+	}
+	// The same day exported in another order
+	second := []*db.TransactionRecord{
+		newTxn("ABCD", 2500, 12000),
+		newTxn("ABCD", 2500, 10000),
+		newTxn("REFUND", -500, 9500),
+	}
+
+	get := func(id string) (*db.TransactionRecord, error) {
+		return nil, nil
+	}
+	for _, records := range [][]*db.TransactionRecord{first, second} {
+		if _, err := classifyTransactions(records, get); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if second[1].GetID() != first[0].GetID() || second[0].GetID() != first[2].GetID() {
+		t.Errorf("expected identical payments to be numbered by their balances, whatever the export order")
+	}
+}
+
+func TestClassifyTransactions_SeparateStatements(t *testing.T) {
+	newTxn := func(day int, description string, amount, balance int64) *db.TransactionRecord {
+		return &db.TransactionRecord{Date: mustParseDate("22 Dec 2025").AddDate(0, 0, day), Type: "CR",
+			FirstName: "J", LastName: "SMITH", Description: description, AmountPence: amount, BalancePence: balance}
+	}
+
+	for _, balances := range []bool{true, false} {
+		balance := func(pence int64) int64 {
+			if balances {
+				return pence
+			}
+			return 0
+		}
+
+		stored := make(map[string]*db.TransactionRecord)
+		get := func(id string) (*db.TransactionRecord, error) {
+			return stored[id], nil
+		}
+		importAll := func(records []*db.TransactionRecord) *transactionImport {
+			imported, err := classifyTransactions(records, get)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for _, record := range imported.New {
+				stored[record.GetID()] = record
+			}
+			return imported
+		}
+
+		// A statement downloaded partway through the day, then one starting from the rest of the day
+		importAll([]*db.TransactionRecord{
+			newTxn(-1, "WXYZ", 3000, balance(7500)),
+			newTxn(0, "ABCD", 2500, balance(10000)),
+		})
+		imported := importAll([]*db.TransactionRecord{
+			newTxn(0, "ABCD", 2500, balance(12500)),
+			newTxn(1, "LMNO", 1000, balance(13500)),
+		})
+		if balances && (len(imported.New) != 2 || len(imported.Skipped) != 0 || len(imported.Conflicting) != 0) {
+			t.Errorf("expected the second identical payment to be new, got %s", imported)
+		}
+		// Without balances the payment cannot be told from the one imported, so it is reported
+		if !balances && (len(imported.New) != 1 || len(imported.Unsure) != 1 ||
+			!strings.Contains(imported.String(), "cannot be told whether they are further payments")) {
+			t.Errorf("expected the second identical payment to be reported as unsure, got %s", imported)
+		}
+
+		// The whole period downloaded again
+		imported = importAll([]*db.TransactionRecord{
+			newTxn(-1, "WXYZ", 3000, balance(7500)),
+			newTxn(0, "ABCD", 2500, balance(10000)),
+			newTxn(0, "ABCD", 2500, balance(12500)),
+			newTxn(1, "LMNO", 1000, balance(13500)),
+		})
+		if balances && (len(imported.New) != 0 || len(imported.Skipped) != 4) {
+			t.Errorf("expected everything to be skipped, got %s", imported)
+		}
+		// Without balances the second identical payment is seen for the first time
+		if !balances && (len(imported.New) != 1 || len(imported.Skipped) != 3) {
+			t.Errorf("expected the second identical payment to be new, got %s", imported)
+		}
+	}
+}
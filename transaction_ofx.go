@@ -0,0 +1,134 @@
+package main
+
+import (
+	"benjitucker/bathrc-accounts/db"
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"sort"
+	"strings"
+	"time"
+)
+
+// isOFX reports whether an uploaded statement is in OFX format, either the SGML (1.x) or XML (2.x) version.
+func isOFX(data []byte) bool {
+	head := bytes.ToUpper(bytes.TrimSpace(data))
+	return bytes.HasPrefix(head, []byte("OFXHEADER")) || bytes.Contains(head, []byte("<OFX>"))
+}
+
+// statementType maps a transaction type and amount from an OFX or QIF statement onto the bank's CSV type codes, so
+// the transactions are matched the same way whichever format is uploaded.
+func statementType(kind string, amount int64) string {
+	switch strings.ToUpper(kind) {
+	case "FEE", "SRVCHG":
+		return "CHG"
+	case "DIRECTDEBIT":
+		return "DD"
+	case "POS":
+		return "VIS"
+	}
+	if amount >= 0 {
+		return "CR"
+	}
+	return "BP"
+}
+
+// parseOFXAmount converts an OFX amount, which may use a comma as the decimal point, into pence.
+func parseOFXAmount(s string) (int64, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "+")
+	if !strings.Contains(s, ".") {
+		s = strings.Replace(s, ",", ".", 1)
+	}
+	return parsePence(s)
+}
+
+// parseOFXDate parses the date part of an OFX date time, e.g. "20251222120000.000[+0:GMT]".
+func parseOFXDate(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if len(s) < 8 {
+		return time.Time{}, fmt.Errorf("invalid OFX date %q", s)
+	}
+	return time.Parse("20060102", s[:8])
+}
+
+// parseTransactionsOFX parses the statement transactions from an OFX file. OFX does not give the balance after
+// each transaction, so it is worked back from the ledger balance when there is one.
+func parseTransactionsOFX(data []byte) ([]*db.TransactionRecord, error) {
+	var transactions []*db.TransactionRecord
+	var fields map[string]string
+	var aggregate string
+	var ledgerBalance *int64
+
+	// Split into tags, SGML leaf elements are not closed so the value runs up to the next tag
+	for _, token := range strings.Split(string(data), "<")[1:] {
+		tag, value, found := strings.Cut(token, ">")
+		if !found {
+			return nil, fmt.Errorf("invalid OFX tag %q", token)
+		}
+		tag = strings.ToUpper(strings.TrimSpace(tag))
+		value = html.UnescapeString(strings.TrimSpace(value))
+
+		switch tag {
+		case "STMTTRN", "LEDGERBAL":
+			aggregate = tag
+			fields = make(map[string]string)
+			continue
+		case "/LEDGERBAL":
+			amount, err := parseOFXAmount(fields["BALAMT"])
+			if err != nil {
+				return nil, fmt.Errorf("invalid ledger balance %q: %w", fields["BALAMT"], err)
+			}
+			ledgerBalance = &amount
+			aggregate = ""
+			continue
+		case "/STMTTRN":
+			transaction, err := ofxTransaction(fields)
+			if err != nil {
+				return nil, err
+			}
+			transactions = append(transactions, transaction)
+			aggregate = ""
+			continue
+		}
+
+		if aggregate != "" && !strings.HasPrefix(tag, "/") && value != "" {
+			fields[tag] = value
+		}
+	}
+
+	if transactions == nil {
+		return nil, errors.New("no transactions found in OFX statement")
+	}
+
+	// Oldest first, as in the bank's CSV
+	sort.SliceStable(transactions, func(i, j int) bool {
+		return transactions[i].Date.Before(transactions[j].Date)
+	})
+
+	if ledgerBalance != nil {
+		balance := *ledgerBalance
+		for i := len(transactions) - 1; i >= 0; i-- {
+			transactions[i].BalancePence = balance
+			balance -= transactions[i].AmountPence
+		}
+	}
+
+	return transactions, nil
+}
+
+func ofxTransaction(fields map[string]string) (*db.TransactionRecord, error) {
+	date, err := parseOFXDate(fields["DTPOSTED"])
+	if err != nil {
+		return nil, err
+	}
+
+	amount, err := parseOFXAmount(fields["TRNAMT"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid amount %q: %w", fields["TRNAMT"], err)
+	}
+
+	description := strings.TrimSpace(fields["NAME"] + " " + fields["MEMO"])
+
+	return newTransactionRecord(date, statementType(fields["TRNTYPE"], amount), description, amount, 0), nil
+}
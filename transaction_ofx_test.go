@@ -0,0 +1,98 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseTransactionsOFX_SGML(t *testing.T) {
+	data := []byte(`OFXHEADER:100
+DATA:OFXSGML
+VERSION:102
+
+<OFX>
+<BANKMSGSRSV1>
+<STMTTRNRS>
+<STMTRS>
+<CURDEF>GBP
+<BANKTRANLIST>
+<DTSTART>20251201
+<DTEND>20251231
+<STMTTRN>
+<TRNTYPE>DIRECTDEBIT
+<DTPOSTED>20251223000000.000[0:GMT]
+<TRNAMT>-10.01
+<FITID>2
+<NAME>Spot Payments
+</STMTTRN>
+<STMTTRN>
+<TRNTYPE>CREDIT
+<DTPOSTED>20251222
+<TRNAMT>20.00
+<FITID>1
+<NAME>FOG BA
+<MEMO>BOB FOG &amp; CO
+</STMTTRN>
+</BANKTRANLIST>
+<LEDGERBAL>
+<BALAMT>13121.18
+<DTASOF>20251231
+</LEDGERBAL>
+</STMTRS>
+</STMTTRNRS>
+</BANKMSGSRSV1>
+</OFX>`)
+
+	if !isOFX(data) || isQIF(data) {
+		t.Fatalf("expected OFX to be detected")
+	}
+
+	transactions, err := parseBankStatement(data)
+	if err != nil {
+		t.Fatalf("parseBankStatement returned error: %v", err)
+	}
+	if len(transactions) != 2 {
+		t.Fatalf("expected 2 transactions, got %d", len(transactions))
+	}
+
+	credit := transactions[0]
+	if !credit.Date.Equal(mustParseDate("22 Dec 2025")) || credit.ExpireAt != mustParseDateUnix("22 Dec 2027") {
+		t.Errorf("unexpected date %v", credit.Date)
+	}
+	if credit.Type != "CR" || credit.AmountPence != 2000 || credit.BalancePence != 1313119 {
+		t.Errorf("unexpected credit %+v", credit)
+	}
+	if credit.FirstName != "FOG" || credit.LastName != "BA" || credit.Description != "BOB FOG & CO" {
+		t.Errorf("unexpected description %+v", credit)
+	}
+
+	debit := transactions[1]
+	if debit.Type != "DD" || debit.AmountPence != -1001 || debit.BalancePence != 1312118 {
+		t.Errorf("unexpected debit %+v", debit)
+	}
+}
+
+func TestParseTransactionsOFX_XML(t *testing.T) {
+	data := []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<?OFX OFXHEADER="200" VERSION="220"?>
+<OFX><BANKMSGSRSV1><STMTTRNRS><STMTRS><BANKTRANLIST>
+<STMTTRN><TRNTYPE>XFER</TRNTYPE><DTPOSTED>20260105</DTPOSTED><TRNAMT>25,00</TRNAMT><NAME>J SMITH</NAME><MEMO>ABCD</MEMO></STMTTRN>
+</BANKTRANLIST></STMTRS></STMTTRNRS></BANKMSGSRSV1></OFX>`)
+
+	transactions, err := parseBankStatement(data)
+	if err != nil {
+		t.Fatalf("parseBankStatement returned error: %v", err)
+	}
+	if len(transactions) != 1 {
+		t.Fatalf("expected 1 transaction, got %d", len(transactions))
+	}
+	got := transactions[0]
+	if got.Type != "CR" || got.AmountPence != 2500 || got.Description != "ABCD" || got.LastName != "SMITH" {
+		t.Errorf("unexpected transaction %+v", got)
+	}
+}
+
+func TestParseTransactionsOFX_NoTransactions(t *testing.T) {
+	if _, err := parseTransactionsOFX([]byte("<OFX></OFX>")); err == nil {
+		t.Errorf("expected an error for an empty statement")
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"benjitucker/bathrc-accounts/db"
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// qifDateLayouts are the date layouts seen in QIF downloads, day first as the bank is in the UK.
+var qifDateLayouts = []string{
+	"02/01/2006",
+	"2/1/2006",
+	"02/01/06",
+	"2/1/06",
+	"2/1'06",
+	"2/1'2006",
+	"02-01-2006",
+	"02 Jan 2006",
+	"2006-01-02",
+}
+
+// isQIF reports whether an uploaded statement is in QIF format.
+func isQIF(data []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(data), []byte("!"))
+}
+
+func parseQIFDate(s string) (time.Time, error) {
+	s = strings.ReplaceAll(strings.TrimSpace(s), " ", "")
+	for _, layout := range qifDateLayouts {
+		layout = strings.ReplaceAll(layout, " ", "")
+		if date, err := time.Parse(layout, s); err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid QIF date %q", s)
+}
+
+// parseTransactionsQIF parses the transactions from a QIF bank statement. QIF does not give balances.
+func parseTransactionsQIF(data []byte) ([]*db.TransactionRecord, error) {
+	var transactions []*db.TransactionRecord
+	fields := make(map[byte]string)
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+
+		switch line[0] {
+		case '!':
+			// Header, e.g. "!Type:Bank"
+			continue
+		case '^':
+			// End of a transaction
+			if len(fields) == 0 {
+				continue
+			}
+			transaction, err := qifTransaction(fields)
+			if err != nil {
+				return nil, err
+			}
+			transactions = append(transactions, transaction)
+			fields = make(map[byte]string)
+		default:
+			fields[line[0]] = strings.TrimSpace(line[1:])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if transactions == nil {
+		return nil, errors.New("no transactions found in QIF statement")
+	}
+	return transactions, nil
+}
+
+func qifTransaction(fields map[byte]string) (*db.TransactionRecord, error) {
+	date, err := parseQIFDate(fields['D'])
+	if err != nil {
+		return nil, err
+	}
+
+	amountStr := strings.ReplaceAll(fields['T'], ",", "")
+	if amountStr == "" {
+		amountStr = strings.ReplaceAll(fields['U'], ",", "")
+	}
+	amount, err := parsePence(strings.TrimPrefix(amountStr, "+"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid amount %q: %w", amountStr, err)
+	}
+
+	description := strings.TrimSpace(fields['P'] + " " + fields['M'])
+
+	// The number field holds the bank's transaction type on some downloads
+	return newTransactionRecord(date, statementType(fields['N'], amount), description, amount, 0), nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseTransactionsQIF(t *testing.T) {
+	data := []byte("!Type:Bank\r\n" +
+		"D22/12/2025\r\nT1,020.00\r\nPFOG BA\r\nMBOB FOG\r\n^\r\n" +
+		"D23/12/25\r\nT-10.01\r\nPSpot Payments\r\nNPOS\r\n^\r\n")
+
+	if !isQIF(data) || isOFX(data) {
+		t.Fatalf("expected QIF to be detected")
+	}
+
+	transactions, err := parseBankStatement(data)
+	if err != nil {
+		t.Fatalf("parseBankStatement returned error: %v", err)
+	}
+	if len(transactions) != 2 {
+		t.Fatalf("expected 2 transactions, got %d", len(transactions))
+	}
+
+	credit := transactions[0]
+	if !credit.Date.Equal(mustParseDate("22 Dec 2025")) || credit.Type != "CR" || credit.AmountPence != 102000 {
+		t.Errorf("unexpected credit %+v", credit)
+	}
+	if credit.FirstName != "FOG" || credit.LastName != "BA" || credit.Description != "BOB FOG" {
+		t.Errorf("unexpected description %+v", credit)
+	}
+
+	debit := transactions[1]
+	if !debit.Date.Equal(mustParseDate("23 Dec 2025")) || debit.Type != "VIS" || debit.AmountPence != -1001 {
+		t.Errorf("unexpected debit %+v", debit)
+	}
+}
+
+func TestParseQIFDate(t *testing.T) {
+	for _, s := range []string{"05/01/2026", "5/1/2026", "05/01/26", "5/1'26", "05 Jan 2026", "2026-01-05"} {
+		date, err := parseQIFDate(s)
+		if err != nil {
+			t.Errorf("parseQIFDate(%q) returned error: %v", s, err)
+			continue
+		}
+		if !date.Equal(mustParseDate("05 Jan 2026")) {
+			t.Errorf("parseQIFDate(%q) = %v", s, date)
+		}
+	}
+	if _, err := parseQIFDate("January"); err == nil {
+		t.Errorf("expected an error for an invalid date")
+	}
+}